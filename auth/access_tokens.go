@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"gorm.io/gorm"
+)
+
+// Scopes an access token can be granted.
+const (
+	ScopeSurveysRead    = "surveys:read"
+	ScopeResponsesRead  = "responses:read"
+	ScopeResponsesWrite = "responses:write"
+	ScopeWebhooksAdmin  = "webhooks:admin"
+)
+
+// Scopes lists every scope an access token can be granted.
+var Scopes = []string{ScopeSurveysRead, ScopeResponsesRead, ScopeResponsesWrite, ScopeWebhooksAdmin}
+
+// accessTokenPrefix marks SurveyX tokens so they are easy to recognise, for
+// example by secret scanners.
+const accessTokenPrefix = "sxp_"
+
+// lastUsedResolution limits how often LastUsedAt is written for a busy token.
+const lastUsedResolution = time.Minute
+
+var ErrInvalidAccessToken = errors.New("invalid or expired access token")
+
+// ValidScope reports whether scope is a known access token scope.
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAccessToken stores a new token for the user and returns the token
+// itself, which is only available at this point.
+func CreateAccessToken(userID uint, name string, scopes []string, expiresAt *time.Time) (*models.AccessToken, string, error) {
+	random, _, err := GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token := accessTokenPrefix + random
+
+	accessToken := &models.AccessToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    token[:len(accessTokenPrefix)+6],
+		TokenHash: HashToken(token),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+	}
+	if err := db.DB.Create(accessToken).Error; err != nil {
+		return nil, "", err
+	}
+	return accessToken, token, nil
+}
+
+// AuthenticateAccessToken looks up an unexpired token and records its use.
+func AuthenticateAccessToken(token string) (*models.AccessToken, error) {
+	var accessToken models.AccessToken
+	if err := db.DB.Where("token_hash = ?", HashToken(token)).First(&accessToken).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAccessToken
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if accessToken.ExpiresAt != nil && !now.Before(*accessToken.ExpiresAt) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	if accessToken.LastUsedAt == nil || now.Sub(*accessToken.LastUsedAt) >= lastUsedResolution {
+		accessToken.LastUsedAt = &now
+		if err := db.DB.Model(&accessToken).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &accessToken, nil
+}
+
+// TokenScopes returns the scopes of the access token a request was
+// authenticated with. ok is false for session authenticated requests, which
+// are not limited by scopes.
+func TokenScopes(ctx context.Context) (scopes []string, ok bool) {
+	scopes, ok = ctx.Value("scopes").([]string)
+	return scopes, ok
+}
+
+// HasScope reports whether scopes, as stored on a token, contain scope.
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
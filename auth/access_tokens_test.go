@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidScope(t *testing.T) {
+	for _, scope := range Scopes {
+		assert.True(t, ValidScope(scope))
+	}
+	assert.False(t, ValidScope("surveys:write"))
+	assert.False(t, ValidScope(""))
+}
+
+func TestTokenScopes(t *testing.T) {
+	_, ok := TokenScopes(context.Background())
+	assert.False(t, ok)
+
+	ctx := context.WithValue(context.Background(), "scopes", []string{ScopeSurveysRead})
+	scopes, ok := TokenScopes(ctx)
+	assert.True(t, ok)
+	assert.True(t, HasScope(scopes, ScopeSurveysRead))
+	assert.False(t, HasScope(scopes, ScopeWebhooksAdmin))
+}
+
+func TestRequireScopeRejectsMalformedAuthorization(t *testing.T) {
+	handler := RequireScope(ScopeSurveysRead, func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be called")
+	})
+
+	req := httptest.NewRequest("GET", "/api/surveys", nil)
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
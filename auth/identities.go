@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"gorm.io/gorm"
+)
+
+// ProviderGoogle is the provider name of Google identities.
+const ProviderGoogle = "google"
+
+// ErrIdentityConflict is returned when a provider account uses the email of an
+// existing user but the provider has not verified that email, so the accounts
+// cannot be linked safely.
+var ErrIdentityConflict = errors.New("an account with this email already exists; sign in with your password instead")
+
+// ErrLastLoginMethod is returned when unlinking would leave a user with no way
+// to sign in.
+var ErrLastLoginMethod = errors.New("cannot remove the only way to sign in to this account")
+
+// ExternalIdentity is what a login provider tells us about the user.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// LoginWithIdentity returns the user an external identity belongs to,
+// creating the user or linking the identity to an existing one as needed.
+//
+// An identity that is not linked yet is linked to the user with the same
+// email only if the provider verified the email. If that user never verified
+// the address themselves, their password is cleared, since whoever set it
+// may not own the address.
+func LoginWithIdentity(ext *ExternalIdentity) (*models.User, error) {
+	var user models.User
+	now := time.Now()
+	email := strings.TrimSpace(ext.Email)
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.Identity
+		err := tx.Where("provider = ? AND subject = ?", ext.Provider, ext.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return err
+			}
+			return tx.Model(&identity).Updates(map[string]interface{}{"email": email, "last_login_at": now}).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		found, err := findUserForIdentity(tx, ext, email, &user)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			user = models.User{Email: email, Name: ext.Name, Picture: ext.Picture}
+			if ext.EmailVerified {
+				user.EmailVerifiedAt = &now
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		} else {
+			updates := map[string]interface{}{}
+			if user.EmailVerifiedAt == nil && ext.EmailVerified && strings.EqualFold(user.Email, email) {
+				updates["email_verified_at"] = now
+				updates["password_hash"] = ""
+				user.EmailVerifiedAt = &now
+				user.PasswordHash = ""
+			}
+			if user.Picture == "" && ext.Picture != "" {
+				updates["picture"] = ext.Picture
+				user.Picture = ext.Picture
+			}
+			if len(updates) > 0 {
+				if err := tx.Model(&user).Updates(updates).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Create(&models.Identity{
+			UserID:      user.ID,
+			Provider:    ext.Provider,
+			Subject:     ext.Subject,
+			Email:       email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// findUserForIdentity looks for the user a new identity should be linked to:
+// a user created by Google logins before identities existed, or a user with
+// the same email if the provider verified it.
+func findUserForIdentity(tx *gorm.DB, ext *ExternalIdentity, email string, user *models.User) (bool, error) {
+	if ext.Provider == ProviderGoogle {
+		err := tx.Where("google_id = ?", ext.Subject).First(user).Error
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, err
+		}
+	}
+
+	if email == "" {
+		return false, nil
+	}
+	err := tx.Where("LOWER(email) = LOWER(?)", email).First(user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !ext.EmailVerified {
+		return false, ErrIdentityConflict
+	}
+	return true, nil
+}
+
+// UnlinkIdentity removes one of the user's identities, unless it is their
+// only way to sign in.
+func UnlinkIdentity(userID, identityID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("id", "password_hash", "google_id").First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		var identity models.Identity
+		if err := tx.Where("user_id = ?", userID).First(&identity, identityID).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.Identity{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count <= 1 && user.PasswordHash == "" {
+			return ErrLastLoginMethod
+		}
+
+		// Clear the legacy Google ID too, or the next Google login would link
+		// the account again.
+		if identity.Provider == ProviderGoogle && user.GoogleID != nil && *user.GoogleID == identity.Subject {
+			if err := tx.Model(&user).Update("google_id", nil).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&identity).Error
+	})
+}
@@ -2,9 +2,11 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/antonlindstrom/pgstore"
 	"github.com/gorilla/sessions"
@@ -32,7 +34,7 @@ func InitStore() {
 	// Set session options
 	Store.Options = &sessions.Options{
 		Path:     "/",
-		MaxAge:   86400 * 7, // 7 days
+		MaxAge:   int(SessionTTL.Seconds()),
 		HttpOnly: true,
 		Secure:   false, // Set to true if using HTTPS
 		SameSite: http.SameSiteLaxMode,
@@ -67,8 +69,51 @@ func ClearSession(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 }
+
+// AuthMiddleware lets signed in users through and puts their ID in the
+// request context as "userID". Routes that access tokens may call are wrapped
+// with RequireScope instead.
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return RequireScope("", next)
+}
+
+// RequireScope authenticates the request with either the session cookie or an
+// "Authorization: Bearer" access token. Tokens must carry scope; with an empty
+// scope only sessions are accepted. Token requests also get the token's scopes
+// in the context as "scopes", session requests the session record's ID as
+// "sessionID".
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get("Authorization"); header != "" {
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			accessToken, err := AuthenticateAccessToken(strings.TrimSpace(token))
+			if err != nil {
+				if !errors.Is(err, ErrInvalidAccessToken) {
+					log.Printf("Error authenticating access token: %v", err)
+				}
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			scopes := strings.Fields(accessToken.Scopes)
+			if scope == "" || !HasScope(scopes, scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				http.Error(w, "Access token is missing the required scope", http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "userID", accessToken.UserID)
+			ctx = context.WithValue(ctx, "scopes", scopes)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		session, err := Store.Get(r, "session-name")
 		if err != nil {
 			log.Printf("Error getting session: %v", err)
@@ -88,12 +133,27 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		token, _ := session.Values["sid"].(string)
+		record, err := CheckSession(userID, token)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidSession) {
+				log.Printf("Error checking session: %v", err)
+			}
+			http.Error(w, "Invalid user session", http.StatusUnauthorized)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), "userID", userID)
+		ctx = context.WithValue(ctx, "sessionID", record.ID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
+
+// passwordCost is the bcrypt cost of stored password hashes.
+const passwordCost = 14
+
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
 	return string(bytes), err
 }
 
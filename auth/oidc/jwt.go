@@ -0,0 +1,253 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew is how far the provider's clock may be off from ours.
+const clockSkew = time.Minute
+
+// keyRefreshInterval limits how often an unknown key ID makes us fetch the
+// key set again, so forged tokens cannot make us hammer the provider.
+const keyRefreshInterval = time.Minute
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type idTokenClaims struct {
+	Issuer        string          `json:"iss"`
+	Subject       string          `json:"sub"`
+	Audience      audience        `json:"aud"`
+	AuthorizedBy  string          `json:"azp"`
+	Expiry        int64           `json:"exp"`
+	IssuedAt      int64           `json:"iat"`
+	NotBefore     int64           `json:"nbf"`
+	Nonce         string          `json:"nonce"`
+	Email         string          `json:"email"`
+	EmailVerified json.RawMessage `json:"email_verified"`
+	Name          string          `json:"name"`
+	Picture       string          `json:"picture"`
+}
+
+// audience is the aud claim, which is either a string or an array.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// VerifyIDToken checks the signature and claims of a raw ID token and that
+// its nonce matches. Only RS256 signatures are accepted.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*Claims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+
+	keys, err := p.signingKeys(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	verified := false
+	for _, key := range keys {
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var claims idTokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	if err := p.checkClaims(&claims, nonce); err != nil {
+		return nil, err
+	}
+
+	return &Claims{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: parseBool(claims.EmailVerified),
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+	}, nil
+}
+
+func (p *Provider) checkClaims(claims *idTokenClaims, nonce string) error {
+	if !p.validIssuer(claims.Issuer) {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	if !claims.Audience.contains(p.ClientID) {
+		return fmt.Errorf("%w: not issued for this client", ErrInvalidToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedBy != p.ClientID {
+		return fmt.Errorf("%w: authorized party is not this client", ErrInvalidToken)
+	}
+
+	now := p.now()
+	if claims.Expiry == 0 || now.After(time.Unix(claims.Expiry, 0).Add(clockSkew)) {
+		return fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	}
+	if claims.NotBefore != 0 && time.Unix(claims.NotBefore, 0).After(now.Add(clockSkew)) {
+		return fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	return nil
+}
+
+func (p *Provider) validIssuer(iss string) bool {
+	if strings.TrimSuffix(iss, "/") == p.Issuer {
+		return true
+	}
+	for _, extra := range p.ExtraIssuers {
+		if iss == extra {
+			return true
+		}
+	}
+	return false
+}
+
+// signingKeys returns the keys that may have signed a token with key ID kid.
+// An unknown kid means the provider may have rotated its keys, so the key set
+// is fetched again, at most once per keyRefreshInterval.
+func (p *Provider) signingKeys(ctx context.Context, kid string) ([]*rsa.PublicKey, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys == nil || (kid != "" && p.keys[kid] == nil && p.now().Sub(p.keysFetchedAt) >= keyRefreshInterval) {
+		var set jwks
+		if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+			return nil, fmt.Errorf("oidc: fetching keys: %w", err)
+		}
+		keys := make(map[string]*rsa.PublicKey)
+		for _, k := range set.Keys {
+			if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+				continue
+			}
+			key, err := rsaKey(k.N, k.E)
+			if err != nil {
+				continue
+			}
+			keys[k.Kid] = key
+		}
+		p.keys = keys
+		p.keysFetchedAt = p.now()
+	}
+
+	if kid != "" {
+		if key := p.keys[kid]; key != nil {
+			return []*rsa.PublicKey{key}, nil
+		}
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+	}
+	keys := make([]*rsa.PublicKey, 0, len(p.keys))
+	for _, key := range p.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(eb)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(exponent.Int64())}, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// parseBool reads email_verified, which some providers send as a string.
+func parseBool(raw json.RawMessage) bool {
+	var b bool
+	if json.Unmarshal(raw, &b) == nil {
+		return b
+	}
+	var s string
+	return json.Unmarshal(raw, &s) == nil && strings.EqualFold(s, "true")
+}
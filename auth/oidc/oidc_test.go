@@ -0,0 +1,246 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockServer is a minimal OIDC provider that issues ID tokens for whatever
+// claims the test sets.
+type mockServer struct {
+	*httptest.Server
+	t      *testing.T
+	key    *rsa.PrivateKey
+	kid    string
+	claims map[string]interface{}
+
+	challenge     string
+	jwksRequests  int
+	discoveryBody map[string]interface{}
+}
+
+func newMockServer(t *testing.T) *mockServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	m := &mockServer{t: t, key: key, kid: "key-1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		}
+		for k, v := range m.discoveryBody {
+			body[k] = v
+		}
+		json.NewEncoder(w).Encode(body)
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.jwksRequests++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": m.kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     m.sign(m.claims),
+		})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockServer) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": m.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	require.NoError(m.t, err)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (m *mockServer) validClaims(nonce string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            m.URL,
+		"sub":            "user-123",
+		"aud":            "client-id",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}
+}
+
+func (m *mockServer) provider() *Provider {
+	return NewProvider(Config{
+		Name:         "mock",
+		Issuer:       m.URL,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost:8080/auth/mock/callback",
+	})
+}
+
+func TestLoginFlow(t *testing.T) {
+	m := newMockServer(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	state, nonce, verifier := NewFlow()
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	require.NoError(t, err)
+
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	q := u.Query()
+	assert.Equal(t, m.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, state, q.Get("state"))
+	assert.Equal(t, nonce, q.Get("nonce"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+	assert.Equal(t, "client-id", q.Get("client_id"))
+	assert.Equal(t, "openid email profile", q.Get("scope"))
+	m.challenge = q.Get("code_challenge")
+
+	m.claims = m.validClaims(nonce)
+	claims, err := p.Exchange(ctx, "good-code", verifier, nonce)
+	require.NoError(t, err)
+	assert.Equal(t, &Claims{Subject: "user-123", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}, claims)
+
+	_, err = p.Exchange(ctx, "good-code", "wrong-verifier", nonce)
+	assert.Error(t, err)
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	m := newMockServer(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	tests := map[string]func(map[string]interface{}){
+		"wrong issuer":   func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+		"wrong audience": func(c map[string]interface{}) { c["aud"] = "other-client" },
+		"other azp":      func(c map[string]interface{}) { c["aud"] = []string{"client-id", "other"}; c["azp"] = "other" },
+		"expired":        func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no expiry":      func(c map[string]interface{}) { delete(c, "exp") },
+		"future iat":     func(c map[string]interface{}) { c["iat"] = time.Now().Add(time.Hour).Unix() },
+		"wrong nonce":    func(c map[string]interface{}) { c["nonce"] = "other" },
+		"no subject":     func(c map[string]interface{}) { delete(c, "sub") },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := m.validClaims("nonce")
+			mutate(claims)
+			_, err := p.VerifyIDToken(ctx, m.sign(claims), "nonce")
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+
+	t.Run("tampered payload", func(t *testing.T) {
+		token := m.sign(m.validClaims("nonce"))
+		parts := strings.Split(token, ".")
+		other, _ := json.Marshal(map[string]interface{}{"sub": "admin"})
+		parts[1] = base64.RawURLEncoding.EncodeToString(other)
+		_, err := p.VerifyIDToken(ctx, strings.Join(parts, "."), "nonce")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("alg none", func(t *testing.T) {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+		payload, _ := json.Marshal(m.validClaims("nonce"))
+		token := header + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+		_, err := p.VerifyIDToken(ctx, token, "nonce")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		other := newMockServer(t)
+		claims := m.validClaims("nonce")
+		_, err := p.VerifyIDToken(ctx, other.sign(claims), "nonce")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+}
+
+func TestVerifyIDTokenAcceptsStringEmailVerifiedAndAudienceList(t *testing.T) {
+	m := newMockServer(t)
+	p := m.provider()
+
+	claims := m.validClaims("nonce")
+	claims["email_verified"] = "true"
+	claims["aud"] = []string{"client-id", "api"}
+	claims["azp"] = "client-id"
+
+	got, err := p.VerifyIDToken(context.Background(), m.sign(claims), "nonce")
+	require.NoError(t, err)
+	assert.True(t, got.EmailVerified)
+}
+
+func TestKeyRotation(t *testing.T) {
+	m := newMockServer(t)
+	p := m.provider()
+	now := time.Now()
+	p.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := p.VerifyIDToken(ctx, m.sign(m.validClaims("nonce")), "nonce")
+	require.NoError(t, err)
+	assert.Equal(t, 1, m.jwksRequests)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	m.key, m.kid = key, "key-2"
+
+	// Unknown keys are only fetched again once the refresh interval passed.
+	_, err = p.VerifyIDToken(ctx, m.sign(m.validClaims("nonce")), "nonce")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, 1, m.jwksRequests)
+
+	now = now.Add(keyRefreshInterval)
+	_, err = p.VerifyIDToken(ctx, m.sign(m.validClaims("nonce")), "nonce")
+	require.NoError(t, err)
+	assert.Equal(t, 2, m.jwksRequests)
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockServer(t)
+	m.discoveryBody = map[string]interface{}{"issuer": "https://evil.example.com"}
+
+	_, err := m.provider().AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	assert.ErrorIs(t, err, ErrDiscovery)
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"gorm.io/gorm"
+)
+
+// SessionTTL is how long a browser session stays signed in.
+const SessionTTL = 7 * 24 * time.Hour
+
+// lastSeenInterval limits how often a session's last seen time is written.
+const lastSeenInterval = time.Minute
+
+var ErrInvalidSession = errors.New("session has expired or was revoked")
+
+// StartSession signs session in as userID, records it and saves it. The
+// session gets a fresh store ID so an ID planted before the login cannot be
+// used afterwards.
+func StartSession(w http.ResponseWriter, r *http.Request, session *sessions.Session, userID uint, ip string) error {
+	token, hash, err := GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	record := &models.UserSession{
+		UserID:     userID,
+		TokenHash:  hash,
+		IP:         ip,
+		UserAgent:  r.UserAgent(),
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(SessionTTL),
+	}
+	if err := db.DB.Create(record).Error; err != nil {
+		return err
+	}
+
+	session.ID = ""
+	session.Values = map[interface{}]interface{}{
+		"authenticated": true,
+		"user_id":       userID,
+		"sid":           token,
+	}
+	return session.Save(r, w)
+}
+
+// CheckSession returns the record of an active session of userID and marks
+// it as seen.
+func CheckSession(userID uint, token string) (*models.UserSession, error) {
+	if token == "" {
+		return nil, ErrInvalidSession
+	}
+
+	now := time.Now()
+	var record models.UserSession
+	err := db.DB.Where("token_hash = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", HashToken(token), userID, now).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidSession
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if now.Sub(record.LastSeenAt) >= lastSeenInterval {
+		db.DB.Model(&record).Update("last_seen_at", now)
+	}
+	return &record, nil
+}
+
+// EndSession revokes the session holding token, if any.
+func EndSession(token string) error {
+	if token == "" {
+		return nil
+	}
+	return db.DB.Model(&models.UserSession{}).
+		Where("token_hash = ? AND revoked_at IS NULL", HashToken(token)).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeSessions revokes every active session of userID except the one with
+// record ID except; pass 0 to revoke them all.
+func RevokeSessions(tx *gorm.DB, userID, except uint) error {
+	query := tx.Model(&models.UserSession{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if except != 0 {
+		query = query.Where("id <> ?", except)
+	}
+	return query.Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Login throttling. Failed logins are counted per account and per client
+// address in the login_throttles table. After a few failures on an account
+// each further attempt has to wait longer; after accountLockThreshold the
+// account is locked for accountLockDuration. Addresses are only locked, at a
+// higher threshold since many users can share one. Counters reset once
+// failureWindow passes without a failure.
+const (
+	delayAfterFailures   = 3
+	maxLoginDelay        = time.Minute
+	accountLockThreshold = 10
+	accountLockDuration  = 15 * time.Minute
+	ipLockThreshold      = 100
+	ipLockDuration       = 15 * time.Minute
+	failureWindow        = time.Hour
+)
+
+// LoginDelay returns how long to wait after the given number of consecutive
+// failures before the next attempt is allowed.
+func LoginDelay(failures int) time.Duration {
+	if failures < delayAfterFailures {
+		return 0
+	}
+	if n := failures - delayAfterFailures; n < 7 {
+		if delay := time.Second << n; delay < maxLoginDelay {
+			return delay
+		}
+	}
+	return maxLoginDelay
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginReservation is a login attempt that ReserveLogin has already counted as
+// a failure. Counting before the password is checked means a burst of parallel
+// attempts cannot all pass the throttle before any failure is recorded.
+type LoginReservation struct {
+	email string
+	ip    string
+	// LockedUntil is set if counting this attempt locked the account.
+	LockedUntil *time.Time
+	ipLocked    bool
+}
+
+// ReserveLogin counts an attempt against the account and the address before
+// the credentials are checked. If the client has to wait first it returns how
+// long and counts nothing. Unknown emails are throttled the same way so the
+// response does not reveal which accounts exist.
+func ReserveLogin(email, ip string, now time.Time) (*LoginReservation, time.Duration, error) {
+	res := &LoginReservation{email: email, ip: ip}
+	var wait time.Duration
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// Always lock the account row before the address row so concurrent
+		// reservations cannot deadlock.
+		account, err := lockThrottle(tx, accountKey(email), now)
+		if err != nil {
+			return err
+		}
+		address, err := lockThrottle(tx, ipKey(ip), now)
+		if err != nil {
+			return err
+		}
+
+		wait = maxDuration(throttleWait(account, now, true), throttleWait(address, now, false))
+		if wait > 0 {
+			return nil
+		}
+
+		res.LockedUntil = countFailure(account, accountLockThreshold, accountLockDuration, now)
+		res.ipLocked = countFailure(address, ipLockThreshold, ipLockDuration, now) != nil
+		if err := tx.Save(account).Error; err != nil {
+			return err
+		}
+		return tx.Save(address).Error
+	})
+	if err != nil || wait > 0 {
+		return nil, wait, err
+	}
+	return res, 0, nil
+}
+
+// Release takes back the count for an attempt that turned out not to be a
+// failed login, leaving earlier failures in place.
+func (res *LoginReservation) Release() error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := uncountFailure(tx, accountKey(res.email), res.LockedUntil != nil, accountLockThreshold); err != nil {
+			return err
+		}
+		return uncountFailure(tx, ipKey(res.ip), res.ipLocked, ipLockThreshold)
+	})
+}
+
+// Succeed clears the failures of the account. The address only loses the
+// count for this attempt so one valid account cannot be used to reset it.
+func (res *LoginReservation) Succeed() error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("key = ?", accountKey(res.email)).Delete(&models.LoginThrottle{}).Error; err != nil {
+			return err
+		}
+		return uncountFailure(tx, ipKey(res.ip), res.ipLocked, ipLockThreshold)
+	})
+}
+
+// lockThrottle loads the row for key, creating it if needed, and locks it until
+// the end of tx.
+func lockThrottle(tx *gorm.DB, key string, now time.Time) (*models.LoginThrottle, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginThrottle{Key: key, LastFailureAt: now}).Error; err != nil {
+		return nil, err
+	}
+
+	var t models.LoginThrottle
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// throttleWait returns how long t makes the client wait. Only accounts are
+// delayed after a few failures; addresses are only locked.
+func throttleWait(t *models.LoginThrottle, now time.Time, delay bool) time.Duration {
+	if now.Sub(t.LastFailureAt) > failureWindow {
+		return 0
+	}
+	var wait time.Duration
+	if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+		wait = t.LockedUntil.Sub(now)
+	}
+	if delay {
+		wait = maxDuration(wait, t.LastFailureAt.Add(LoginDelay(t.Failures)).Sub(now))
+	}
+	return wait
+}
+
+// countFailure adds a failure to t. It returns when t is locked until if this
+// failure reached the threshold.
+func countFailure(t *models.LoginThrottle, threshold int, lockFor time.Duration, now time.Time) *time.Time {
+	if now.Sub(t.LastFailureAt) > failureWindow {
+		t.Failures = 0
+		t.LockedUntil = nil
+	}
+	t.Failures++
+	t.LastFailureAt = now
+
+	if t.Failures >= threshold && (t.LockedUntil == nil || !now.Before(*t.LockedUntil)) {
+		until := now.Add(lockFor)
+		t.LockedUntil = &until
+		// Start counting again once the lock runs out.
+		t.Failures = 0
+		return &until
+	}
+	return nil
+}
+
+// uncountFailure removes one failure from key. If counting it locked the key,
+// the lock is lifted and the count put back just below the threshold.
+func uncountFailure(tx *gorm.DB, key string, locked bool, threshold int) error {
+	if locked {
+		return tx.Model(&models.LoginThrottle{}).Where("key = ?", key).
+			Updates(map[string]interface{}{"locked_until": nil, "failures": threshold - 1}).Error
+	}
+	return tx.Model(&models.LoginThrottle{}).Where("key = ? AND failures > 0", key).
+		Update("failures", gorm.Expr("failures - 1")).Error
+}
+
+// AuditLogin writes an attempt to the login_attempts table.
+func AuditLogin(attempt *models.LoginAttempt) error {
+	return db.DB.Create(attempt).Error
+}
+
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// CheckPasswordOrDummy compares password with hash like CheckPasswordHash, but
+// when there is no hash (unknown email or an account without a password) it
+// compares against a dummy hash of the same cost so the response takes as
+// long either way.
+func CheckPasswordOrDummy(password, hash string) bool {
+	if hash == "" {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("surveyx-dummy-password"), passwordCost)
+		})
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return CheckPasswordHash(password, hash)
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginDelay(t *testing.T) {
+	assert.Equal(t, time.Duration(0), LoginDelay(0))
+	assert.Equal(t, time.Duration(0), LoginDelay(2))
+	assert.Equal(t, time.Second, LoginDelay(3))
+	assert.Equal(t, 2*time.Second, LoginDelay(4))
+	assert.Equal(t, 32*time.Second, LoginDelay(8))
+	assert.Equal(t, time.Minute, LoginDelay(9))
+	assert.Equal(t, time.Minute, LoginDelay(1000))
+}
+
+func TestAccountKeyIgnoresCase(t *testing.T) {
+	assert.Equal(t, accountKey("Ana@Example.com "), accountKey("ana@example.com"))
+}
+
+func TestCheckPasswordOrDummy(t *testing.T) {
+	if testing.Short() {
+		t.Skip("bcrypt at production cost is slow")
+	}
+	assert.False(t, CheckPasswordOrDummy("password", ""))
+}
+
+func TestCountFailureLocksAtThreshold(t *testing.T) {
+	now := time.Now()
+	account := &models.LoginThrottle{Key: accountKey("ana@example.com"), LastFailureAt: now}
+	for i := 1; i < accountLockThreshold; i++ {
+		assert.Nil(t, countFailure(account, accountLockThreshold, accountLockDuration, now))
+	}
+	assert.Equal(t, accountLockThreshold-1, account.Failures)
+
+	lockedUntil := countFailure(account, accountLockThreshold, accountLockDuration, now)
+	if assert.NotNil(t, lockedUntil) {
+		assert.Equal(t, now.Add(accountLockDuration), *lockedUntil)
+	}
+	assert.Equal(t, 0, account.Failures)
+	assert.Equal(t, accountLockDuration, throttleWait(account, now, true))
+
+	// Failures while locked do not extend the lock.
+	assert.Nil(t, countFailure(account, accountLockThreshold, accountLockDuration, now.Add(time.Minute)))
+}
+
+func TestCountFailureResetsAfterWindow(t *testing.T) {
+	now := time.Now()
+	account := &models.LoginThrottle{Failures: 5, LastFailureAt: now.Add(-failureWindow - time.Second)}
+	assert.Equal(t, time.Duration(0), throttleWait(account, now, true))
+
+	countFailure(account, accountLockThreshold, accountLockDuration, now)
+	assert.Equal(t, 1, account.Failures)
+}
+
+func TestAddressCounterOnlyLocks(t *testing.T) {
+	now := time.Now()
+	address := &models.LoginThrottle{Key: ipKey("203.0.113.7"), LastFailureAt: now}
+	for i := 1; i < ipLockThreshold; i++ {
+		assert.Nil(t, countFailure(address, ipLockThreshold, ipLockDuration, now))
+	}
+	// Many failures from one address are not delayed like an account.
+	assert.Equal(t, time.Duration(0), throttleWait(address, now, false))
+
+	assert.NotNil(t, countFailure(address, ipLockThreshold, ipLockDuration, now))
+	assert.Equal(t, ipLockDuration, throttleWait(address, now, false))
+	assert.Equal(t, time.Duration(0), throttleWait(address, now.Add(ipLockDuration), false))
+}
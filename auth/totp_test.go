@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFC(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		code, err := TOTPCode(rfcSecret, time.Unix(tt.unix, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, tt.code, code, tt.unix)
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	assert.NoError(t, err)
+
+	now := time.Now()
+	code, _ := TOTPCode(secret, now)
+
+	step, ok := VerifyTOTP(secret, code, now, 0)
+	assert.True(t, ok)
+
+	// A used code cannot be replayed.
+	_, ok = VerifyTOTP(secret, code, now, step)
+	assert.False(t, ok)
+
+	// Codes from the neighbouring periods are accepted, older ones are not.
+	previous, _ := TOTPCode(secret, now.Add(-30*time.Second))
+	_, ok = VerifyTOTP(secret, previous, now, 0)
+	assert.True(t, ok)
+	old, _ := TOTPCode(secret, now.Add(-2*time.Minute))
+	_, ok = VerifyTOTP(secret, old, now, 0)
+	assert.False(t, ok)
+
+	_, ok = VerifyTOTP(secret, "12345", now, 0)
+	assert.False(t, ok)
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("ABC", "ana@example.com", "SurveyX")
+	assert.Equal(t, "otpauth://totp/SurveyX:ana@example.com?algorithm=SHA1&digits=6&issuer=SurveyX&period=30&secret=ABC", uri)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(10)
+	assert.NoError(t, err)
+	assert.Len(t, codes, 10)
+	assert.Equal(t, hashes[0], HashRecoveryCode(codes[0]))
+	assert.Equal(t, hashes[0], HashRecoveryCode(" "+codes[0][:4]+codes[0][5:]))
+	assert.NotEqual(t, hashes[0], hashes[1])
+}
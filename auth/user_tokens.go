@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"gorm.io/gorm"
+)
+
+// Purposes of user tokens. A token only works for the purpose it was issued
+// for.
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposePasswordReset     = "password_reset"
+)
+
+var ErrInvalidUserToken = errors.New("token is invalid or has expired")
+
+// signingKey keys user token hashes. TOKEN_SIGNING_KEY falls back to
+// SESSION_KEY.
+func signingKey() []byte {
+	if key := os.Getenv("TOKEN_SIGNING_KEY"); key != "" {
+		return []byte(key)
+	}
+	return []byte(os.Getenv("SESSION_KEY"))
+}
+
+// SignToken returns the keyed hash stored for a user token.
+func SignToken(token string) string {
+	mac := hmac.New(sha256.New, signingKey())
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IssueUserToken creates a token for purpose that expires after ttl. Earlier
+// unused tokens for the same user and purpose stop working.
+func IssueUserToken(tx *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, _, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Transaction(func(tx *gorm.DB) error {
+		if err := revokeUserTokens(tx, userID, purpose); err != nil {
+			return err
+		}
+		return tx.Create(&models.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: SignToken(token),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeUserToken marks an unused, unexpired token for purpose as used and
+// returns its user ID. A token can only be consumed once, even by concurrent
+// requests.
+func ConsumeUserToken(tx *gorm.DB, purpose, token string) (uint, error) {
+	var userToken models.UserToken
+	if err := tx.Where("token_hash = ? AND purpose = ?", SignToken(token), purpose).First(&userToken).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrInvalidUserToken
+		}
+		return 0, err
+	}
+
+	now := time.Now()
+	result := tx.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", userToken.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, ErrInvalidUserToken
+	}
+	return userToken.UserID, nil
+}
+
+func revokeUserTokens(tx *gorm.DB, userID uint, purpose string) error {
+	return tx.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
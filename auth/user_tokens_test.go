@@ -0,0 +1,18 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignToken(t *testing.T) {
+	t.Setenv("TOKEN_SIGNING_KEY", "first")
+	first := SignToken("token")
+	assert.Equal(t, first, SignToken("token"))
+	assert.NotEqual(t, first, SignToken("other"))
+	assert.NotEqual(t, HashToken("token"), first)
+
+	t.Setenv("TOKEN_SIGNING_KEY", "second")
+	assert.NotEqual(t, first, SignToken("token"))
+}
@@ -0,0 +1,119 @@
+// Package authz decides which surveys, responses, webhooks and teams a user
+// may access, and what they may do with them.
+//
+// A user has every permission on a personal survey they own (Survey.UserID
+// with no team). For a survey that belongs to a team (Survey.TeamID), the
+// user's role in that team decides which actions are allowed; the team's
+// OwnerID always counts as the owner role. Handlers load records through these
+// scopes so that a denied record looks exactly like a missing one and IDs of
+// other users' data are not leaked.
+package authz
+
+import (
+	"errors"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned when a record does not exist or the user may not
+// access it. Handlers should answer it with 404.
+var ErrNotFound = errors.New("not found")
+
+// teamAccess matches the team IDs in which a user holds one of the given
+// roles. It takes the user ID, the roles and the user ID again.
+const teamAccess = "(SELECT team_id FROM user_teams WHERE user_id = ? AND role IN ?) " +
+	"UNION (SELECT id FROM teams WHERE owner_id = ? AND deleted_at IS NULL)"
+
+// surveyAccess matches the surveys on which a user may perform an action. It
+// takes the user ID, followed by the arguments of teamAccess.
+const surveyAccess = "((surveys.team_id IS NULL AND surveys.user_id = ?) OR surveys.team_id IN (" + teamAccess + "))"
+
+// Surveys scopes a query on the surveys table to the surveys on which userID
+// may perform action.
+func Surveys(userID uint, action Action) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where(surveyAccess, userID, userID, rolesWith(action), userID)
+	}
+}
+
+// Survey loads the survey with the given ID into dest if userID may perform
+// action on it. Preloads and other clauses can be set on tx beforehand.
+func Survey(tx *gorm.DB, userID, surveyID uint, action Action, dest *models.Survey) error {
+	err := tx.Scopes(Surveys(userID, action)).First(dest, surveyID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// CheckSurvey returns ErrNotFound unless userID may perform action on the
+// survey.
+func CheckSurvey(tx *gorm.DB, userID, surveyID uint, action Action) error {
+	var survey models.Survey
+	return Survey(tx.Select("surveys.id"), userID, surveyID, action, &survey)
+}
+
+// Webhooks scopes a query on the webhooks table to the webhooks userID may
+// manage, which are those attached to surveys where they may manage webhooks.
+func Webhooks(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where(
+			"webhooks.survey_id IN (SELECT surveys.id FROM surveys WHERE surveys.deleted_at IS NULL AND "+surveyAccess+")",
+			userID, userID, rolesWith(ActionManageWebhooks), userID,
+		)
+	}
+}
+
+// Webhook loads the webhook with the given ID into dest if userID may manage
+// it.
+func Webhook(tx *gorm.DB, userID, webhookID uint, dest *models.Webhook) error {
+	err := tx.Scopes(Webhooks(userID)).First(dest, webhookID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// TeamRole returns the role of userID in the team, or ErrNotFound if the team
+// does not exist or the user is not a member. Preloads and other clauses set
+// on tx are meant for the caller's own query and are not applied here.
+func TeamRole(tx *gorm.DB, userID, teamID uint) (string, error) {
+	tx = tx.Session(&gorm.Session{NewDB: true})
+
+	var team models.Team
+	if err := tx.Select("id", "owner_id").First(&team, teamID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	if team.OwnerID == userID {
+		return RoleOwner, nil
+	}
+
+	var member models.TeamMember
+	if err := tx.Where("team_id = ? AND user_id = ?", teamID, userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// Team loads the team with the given ID into dest if userID may perform action
+// on it, and returns the user's role.
+func Team(tx *gorm.DB, userID, teamID uint, action Action, dest *models.Team) (string, error) {
+	role, err := TeamRole(tx, userID, teamID)
+	if err != nil {
+		return "", err
+	}
+	if !Can(role, action) {
+		return "", ErrNotFound
+	}
+	if err := tx.First(dest, teamID).Error; err != nil {
+		return "", err
+	}
+	return role, nil
+}
@@ -0,0 +1,93 @@
+package authz
+
+// Roles a user can hold in a team, from most to least privileged. The role is
+// stored on the user_teams join row (models.TeamMember).
+const (
+	RoleOwner   = "owner"
+	RoleAdmin   = "admin"
+	RoleEditor  = "editor"
+	RoleAnalyst = "analyst"
+	RoleViewer  = "viewer"
+)
+
+// Action is something a user may do with a survey or a team.
+type Action string
+
+const (
+	ActionViewSurvey      Action = "view_survey"
+	ActionEditSurvey      Action = "edit_survey"
+	ActionDeleteSurvey    Action = "delete_survey"
+	ActionPublishSurvey   Action = "publish_survey"
+	ActionViewResponses   Action = "view_responses"
+	ActionExportResponses Action = "export_responses"
+	ActionDeleteResponses Action = "delete_responses"
+	ActionManageWebhooks  Action = "manage_webhooks"
+	ActionViewTeam        Action = "view_team"
+	ActionManageTeam      Action = "manage_team"
+	ActionManageMembers   Action = "manage_members"
+)
+
+var roleRank = map[string]int{
+	RoleOwner:   5,
+	RoleAdmin:   4,
+	RoleEditor:  3,
+	RoleAnalyst: 2,
+	RoleViewer:  1,
+}
+
+var rolePermissions = map[string][]Action{
+	RoleOwner: {
+		ActionViewSurvey, ActionEditSurvey, ActionDeleteSurvey, ActionPublishSurvey,
+		ActionViewResponses, ActionExportResponses, ActionDeleteResponses, ActionManageWebhooks,
+		ActionViewTeam, ActionManageTeam, ActionManageMembers,
+	},
+	RoleAdmin: {
+		ActionViewSurvey, ActionEditSurvey, ActionDeleteSurvey, ActionPublishSurvey,
+		ActionViewResponses, ActionExportResponses, ActionDeleteResponses, ActionManageWebhooks,
+		ActionViewTeam, ActionManageTeam, ActionManageMembers,
+	},
+	RoleEditor: {
+		ActionViewSurvey, ActionEditSurvey, ActionPublishSurvey, ActionViewResponses,
+		ActionViewTeam,
+	},
+	RoleAnalyst: {
+		ActionViewSurvey, ActionViewResponses, ActionExportResponses,
+		ActionViewTeam,
+	},
+	RoleViewer: {
+		ActionViewSurvey,
+		ActionViewTeam,
+	},
+}
+
+// ValidRole reports whether role is one of the known team roles.
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// Can reports whether role grants action.
+func Can(role string, action Action) bool {
+	for _, a := range rolePermissions[role] {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Outranks reports whether role a is at least as privileged as role b.
+func Outranks(a, b string) bool {
+	return roleRank[a] >= roleRank[b]
+}
+
+// rolesWith returns every role that grants action.
+func rolesWith(action Action) []string {
+	roles := make([]string, 0, len(rolePermissions))
+	for _, role := range []string{RoleOwner, RoleAdmin, RoleEditor, RoleAnalyst, RoleViewer} {
+		if Can(role, action) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,33 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCan(t *testing.T) {
+	assert.True(t, Can(RoleOwner, ActionManageMembers))
+	assert.True(t, Can(RoleAdmin, ActionManageWebhooks))
+	assert.True(t, Can(RoleEditor, ActionPublishSurvey))
+	assert.False(t, Can(RoleEditor, ActionExportResponses))
+	assert.True(t, Can(RoleAnalyst, ActionExportResponses))
+	assert.False(t, Can(RoleAnalyst, ActionDeleteResponses))
+	assert.True(t, Can(RoleAdmin, ActionDeleteResponses))
+	assert.False(t, Can(RoleAnalyst, ActionEditSurvey))
+	assert.True(t, Can(RoleViewer, ActionViewSurvey))
+	assert.False(t, Can(RoleViewer, ActionViewResponses))
+	assert.False(t, Can("unknown", ActionViewSurvey))
+}
+
+func TestOutranks(t *testing.T) {
+	assert.True(t, Outranks(RoleOwner, RoleAdmin))
+	assert.True(t, Outranks(RoleAdmin, RoleAdmin))
+	assert.False(t, Outranks(RoleEditor, RoleAdmin))
+	assert.False(t, Outranks(RoleViewer, RoleAnalyst))
+}
+
+func TestRolesWith(t *testing.T) {
+	assert.Equal(t, []string{RoleOwner, RoleAdmin, RoleAnalyst}, rolesWith(ActionExportResponses))
+	assert.Equal(t, []string{RoleOwner, RoleAdmin, RoleEditor, RoleAnalyst, RoleViewer}, rolesWith(ActionViewSurvey))
+}
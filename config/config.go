@@ -1,21 +1,17 @@
 package config
 
 import (
-	"crypto/rand"
-	"encoding/base64"
-	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"time"
+	"strings"
 
 	"github.com/joho/godotenv"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
+	"github.com/nikhilsahni7/SurveyX/auth/oidc"
 )
 
 var (
-    GoogleOauthConfig *oauth2.Config
+    // OIDCProviders are the configured login providers by name.
+    OIDCProviders = map[string]*oidc.Provider{}
 )
 
 func init() {
@@ -23,44 +19,64 @@ func init() {
         log.Printf("Error loading .env file: %v", err)
     }
 
-    GoogleOauthConfig = &oauth2.Config{
-        ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-        ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-        RedirectURL:  "http://localhost:8080/auth/google/callback",
-        Scopes: []string{
-            "https://www.googleapis.com/auth/userinfo.email",
-            "https://www.googleapis.com/auth/userinfo.profile",
-        },
-        Endpoint: google.Endpoint,
+    for _, cfg := range oidcConfigs() {
+        OIDCProviders[cfg.Name] = oidc.NewProvider(cfg)
+        log.Printf("OIDC provider %q initialized with issuer %s and client ID %s", cfg.Name, cfg.Issuer, cfg.ClientID)
     }
-
-    log.Printf("Google OAuth Config initialized with Client ID: %s", GoogleOauthConfig.ClientID)
 }
 
-func GenerateStateOauthCookie(w http.ResponseWriter) string {
-    b := make([]byte, 16)
-    rand.Read(b)
-    state := base64.URLEncoding.EncodeToString(b)
-    cookie := &http.Cookie{
-        Name:     "oauthstate",
-        Value:    state,
-        Expires:  time.Now().Add(30 * time.Minute),
-        HttpOnly: true,
-        Path:     "/",
-        SameSite: http.SameSiteLaxMode,
+// BaseURL is the URL this API is reachable at, used to build OAuth redirect
+// URLs.
+func BaseURL() string {
+    if u := os.Getenv("BASE_URL"); u != "" {
+        return strings.TrimSuffix(u, "/")
     }
-    http.SetCookie(w, cookie)
-    return state
+    return "http://localhost:8080"
 }
 
-func VerifyStateOauthCookie(r *http.Request) error {
-    state := r.FormValue("state")
-    cookie, err := r.Cookie("oauthstate")
-    if err != nil {
-        return err
+// oidcConfigs reads the provider list. Google is configured with
+// GOOGLE_CLIENT_ID and GOOGLE_CLIENT_SECRET; other providers are listed in
+// OIDC_PROVIDERS (e.g. "keycloak,okta") and each configured with
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and
+// optionally OIDC_<NAME>_SCOPES.
+func oidcConfigs() []oidc.Config {
+    var configs []oidc.Config
+
+    if id := os.Getenv("GOOGLE_CLIENT_ID"); id != "" {
+        configs = append(configs, oidc.Config{
+            Name:         "google",
+            Issuer:       "https://accounts.google.com",
+            ClientID:     id,
+            ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+            RedirectURL:  BaseURL() + "/auth/google/callback",
+            ExtraIssuers: []string{"accounts.google.com"},
+        })
     }
-    if cookie.Value != state {
-        return fmt.Errorf("invalid oauth state")
+
+    for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+        name = strings.ToLower(strings.TrimSpace(name))
+        if name == "" {
+            continue
+        }
+        if name == "mfa" || name == "password" {
+            log.Printf("Skipping OIDC provider %q: the name is reserved", name)
+            continue
+        }
+        prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+        cfg := oidc.Config{
+            Name:         name,
+            Issuer:       os.Getenv(prefix + "ISSUER"),
+            ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+            ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+            RedirectURL:  BaseURL() + "/auth/" + name + "/callback",
+            Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+        }
+        if cfg.Issuer == "" || cfg.ClientID == "" {
+            log.Printf("Skipping OIDC provider %q: %sISSUER and %sCLIENT_ID are required", name, prefix, prefix)
+            continue
+        }
+        configs = append(configs, cfg)
     }
-    return nil
+
+    return configs
 }
@@ -70,17 +70,39 @@ func InitDB() {
 }
 
 func migrateSchema() error {
+    // Team memberships carry a role, so use an explicit join model
+    if err := DB.SetupJoinTable(&models.Team{}, "Users", &models.TeamMember{}); err != nil {
+        return err
+    }
+    if err := DB.SetupJoinTable(&models.User{}, "Teams", &models.TeamMember{}); err != nil {
+        return err
+    }
+
     return DB.AutoMigrate(
         &models.User{},
         &models.Team{},
+        &models.TeamInvitation{},
+        &models.AccessToken{},
+        &models.UserToken{},
+        &models.Identity{},
+        &models.UserSession{},
+        &models.MFARecoveryCode{},
+        &models.LoginThrottle{},
+        &models.LoginAttempt{},
         &models.Survey{},
+        &models.Section{},
+        &models.PageRule{},
         &models.Question{},
         &models.Condition{},
         &models.Option{},
+        &models.MatrixRow{},
         &models.Response{},
         &models.Answer{},
         &models.SurveyLink{},
+        &models.SurveyVersion{},
         &models.Webhook{},
+        &models.WebhookDelivery{},
+        &models.WebhookAttempt{},
     )
 }
 
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/auth"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/mailer"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"gorm.io/gorm"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+
+	minPasswordLength = 8
+)
+
+// frontendURL is where links in emails point, from FRONTEND_URL.
+func frontendURL() string {
+	if u := os.Getenv("FRONTEND_URL"); u != "" {
+		return u
+	}
+	return "http://localhost:3000"
+}
+
+// emailVerificationRequired reports whether REQUIRE_EMAIL_VERIFICATION blocks
+// password logins until the email is verified.
+func emailVerificationRequired() bool {
+	required, _ := strconv.ParseBool(os.Getenv("REQUIRE_EMAIL_VERIFICATION"))
+	return required
+}
+
+// inBackground runs fn on its own goroutine with a context that outlives the
+// request. Mail that only goes out for existing accounts is sent this way so
+// the response time does not reveal whether an address is registered.
+func inBackground(ctx context.Context, fn func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+	go fn(ctx)
+}
+
+func sendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, err := auth.IssueUserToken(db.DB, user.ID, auth.PurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your SurveyX email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link:\n\n%s/verify-email?token=%s\n\nThe link expires in 48 hours.\n",
+			user.Name, frontendURL(), url.QueryEscape(token)),
+	})
+}
+
+func sendPasswordResetEmail(ctx context.Context, user *models.User) error {
+	token, err := auth.IssueUserToken(db.DB, user.ID, auth.PurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your SurveyX password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your SurveyX account. If it was you, open this link to choose a new one:\n\n%s/reset-password?token=%s\n\nThe link expires in one hour. If you did not ask for it you can ignore this email.\n",
+			user.Name, frontendURL(), url.QueryEscape(token)),
+	})
+}
+
+// VerifyEmail redeems an email verification token and accepts the team
+// invitations waiting for the address.
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		userID, err := auth.ConsumeUserToken(tx, auth.PurposeEmailVerification, input.Token)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.EmailVerifiedAt == nil {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+			return tx.Model(&user).Update("email_verified_at", now).Error
+		}
+		return nil
+	})
+	if errors.Is(err, auth.ErrInvalidUserToken) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	acceptPendingInvitations(&user)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"})
+}
+
+// ResendVerificationEmail sends a new verification link. It answers the same
+// way whether or not the address belongs to an account.
+func ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := auth.GetUserByEmail(strings.TrimSpace(input.Email))
+	if err == nil && user.EmailVerifiedAt == nil {
+		inBackground(r.Context(), func(ctx context.Context) {
+			if err := sendVerificationEmail(ctx, user); err != nil {
+				log.Printf("Error sending verification email to user %d: %v", user.ID, err)
+			}
+		})
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the address needs verifying, a new link has been sent"})
+}
+
+// ForgotPassword mails a password reset link. It answers the same way whether
+// or not the address belongs to an account.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if user, err := auth.GetUserByEmail(strings.TrimSpace(input.Email)); err == nil {
+		inBackground(r.Context(), func(ctx context.Context) {
+			if err := sendPasswordResetEmail(ctx, user); err != nil {
+				log.Printf("Error sending password reset email to user %d: %v", user.ID, err)
+			}
+		})
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the address belongs to an account, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password using a reset token. Since the token was
+// mailed to the user, it also confirms their email address.
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(input.Password) < minPasswordLength {
+		http.Error(w, fmt.Sprintf("Password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	hash, err := auth.HashPassword(input.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		userID, err := auth.ConsumeUserToken(tx, auth.PurposePasswordReset, input.Token)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"password_hash":     hash,
+			"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+		}).Error; err != nil {
+			return err
+		}
+		// Whoever knew the old password may still be signed in.
+		return auth.RevokeSessions(tx, userID, 0)
+	})
+	if errors.Is(err, auth.ErrInvalidUserToken) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset"})
+}
+
+// ChangePassword replaces the password of the signed in user after checking
+// the current one, and signs out all their other sessions.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(input.NewPassword) < minPasswordLength {
+		http.Error(w, fmt.Sprintf("Password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	// Users who only sign in with a provider have no password to check and set
+	// their first one here.
+	if user.PasswordHash != "" && !auth.CheckPasswordHash(input.CurrentPassword, user.PasswordHash) {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	hash, err := auth.HashPassword(input.NewPassword)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	currentID, _ := r.Context().Value("sessionID").(uint)
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password_hash", hash).Error; err != nil {
+			return err
+		}
+		return auth.RevokeSessions(tx, user.ID, currentID)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed"})
+}
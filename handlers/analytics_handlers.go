@@ -5,12 +5,20 @@ package handlers
 import (
 	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/nikhilsahni7/SurveyX/authz"
 	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/logic"
 	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/nikhilsahni7/SurveyX/validation"
+	"github.com/nikhilsahni7/SurveyX/webhooks"
 )
 
 func GetSurveyAnalytics(w http.ResponseWriter, r *http.Request) {
@@ -21,13 +29,45 @@ func GetSurveyAnalytics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID := r.Context().Value("userID").(uint)
 	var survey models.Survey
-	if err := db.DB.Preload("Questions.Options").Preload("Responses.Answers").First(&survey, surveyID).Error; err != nil {
+	if err := authz.Survey(db.DB.Preload("Questions.Options").Preload("Questions.Rows").Preload("Responses", "status = ?", responseCompleted).Preload("Responses.Answers"), userID, uint(surveyID), authz.ActionViewResponses, &survey); err != nil {
 		http.Error(w, "Survey not found", http.StatusNotFound)
 		return
 	}
 
+	// Resolve answers against the questions of the version that was answered.
+	questions, _, err := answeredQuestions(db.DB, &survey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	survey.Questions = questions
+
 	analytics := calculateAnalytics(&survey)
+
+	// Drafts are not responses yet, but show how many respondents dropped out.
+	var statusCounts []struct {
+		Status string
+		Count  int
+	}
+	if err := db.DB.Model(&models.Response{}).Select("status, COUNT(*) AS count").
+		Where("survey_id = ? AND status <> ?", survey.ID, responseCompleted).
+		Group("status").Scan(&statusCounts).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	analytics["inProgressResponses"] = 0
+	analytics["abandonedResponses"] = 0
+	for _, c := range statusCounts {
+		switch c.Status {
+		case responseDraft:
+			analytics["inProgressResponses"] = c.Count
+		case responseAbandoned:
+			analytics["abandonedResponses"] = c.Count
+		}
+	}
+
 	json.NewEncoder(w).Encode(analytics)
 }
 
@@ -35,16 +75,29 @@ func calculateAnalytics(survey *models.Survey) map[string]interface{} {
 	analytics := make(map[string]interface{})
 	analytics["totalResponses"] = len(survey.Responses)
 
+	responsesByVersion := make(map[int]int)
+	for _, response := range survey.Responses {
+		responsesByVersion[response.Version]++
+	}
+	analytics["responsesByVersion"] = responsesByVersion
+
 	questionAnalytics := make(map[string]interface{})
 	for _, question := range survey.Questions {
 		qa := make(map[string]interface{})
 
-		switch question.Type {
+		switch validation.QuestionType(question) {
 		case "multipleChoice", "checkbox", "dropdown":
 			optionCounts := make(map[string]int)
 			for _, response := range survey.Responses {
 				for _, answer := range response.Answers {
-					if answer.QuestionID == question.ID {
+					if answer.QuestionID != question.ID {
+						continue
+					}
+					if values, ok := logic.MultiValues(answer.Value); ok {
+						for _, value := range values {
+							optionCounts[value]++
+						}
+					} else {
 						optionCounts[answer.Value]++
 					}
 				}
@@ -66,7 +119,58 @@ func calculateAnalytics(survey *models.Survey) map[string]interface{} {
 				qa["average"] = float64(sum) / float64(count)
 			}
 
-		case "text", "textarea":
+		case "matrix":
+			qa["rowCounts"] = matrixCounts(question, answerValues(survey, question))
+
+		case "ranking":
+			averageRank, firstPlace := rankingStats(answerValues(survey, question))
+			qa["averageRank"] = averageRank
+			qa["firstPlaceCounts"] = firstPlace
+
+		case "nps":
+			for k, v := range npsStats(answerValues(survey, question)) {
+				qa[k] = v
+			}
+
+		case "number":
+			var sum float64
+			var count int
+			for _, value := range answerValues(survey, question) {
+				n, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					continue
+				}
+				if count == 0 || n < qa["min"].(float64) {
+					qa["min"] = n
+				}
+				if count == 0 || n > qa["max"].(float64) {
+					qa["max"] = n
+				}
+				sum += n
+				count++
+			}
+			if count > 0 {
+				qa["average"] = sum / float64(count)
+			}
+
+		case "date", "time", "datetime":
+			var earliest, latest time.Time
+			found := false
+			for _, value := range answerValues(survey, question) {
+				t, err := time.Parse(validation.DateTimeLayouts[question.Type], value)
+				if err != nil {
+					continue
+				}
+				if !found || t.Before(earliest) {
+					earliest, qa["earliest"] = t, value
+				}
+				if !found || t.After(latest) {
+					latest, qa["latest"] = t, value
+				}
+				found = true
+			}
+
+		case "text", "textarea", "email", "phone":
 			answers := []string{}
 			for _, response := range survey.Responses {
 				for _, answer := range response.Answers {
@@ -85,6 +189,168 @@ func calculateAnalytics(survey *models.Survey) map[string]interface{} {
 	return analytics
 }
 
+// answerValues returns the non-empty answers to a question.
+func answerValues(survey *models.Survey, question models.Question) []string {
+	var values []string
+	for _, response := range survey.Responses {
+		for _, answer := range response.Answers {
+			if answer.QuestionID == question.ID && !logic.IsEmptyAnswer(question.Type, answer.Value) {
+				values = append(values, answer.Value)
+			}
+		}
+	}
+	return values
+}
+
+// matrixCounts counts how often each column was selected in each row.
+func matrixCounts(question models.Question, values []string) map[string]map[string]int {
+	counts := make(map[string]map[string]int, len(question.Rows))
+	for _, row := range question.Rows {
+		counts[validation.RowValue(row)] = make(map[string]int)
+	}
+	for _, value := range values {
+		rows, err := validation.DecodeMatrix(value)
+		if err != nil {
+			continue
+		}
+		for row, selected := range rows {
+			if counts[row] == nil {
+				counts[row] = make(map[string]int)
+			}
+			for _, column := range selected {
+				counts[row][column]++
+			}
+		}
+	}
+	return counts
+}
+
+// rankingStats returns the average rank of each option, 1 being the best,
+// over the rankings that include it, and how often each option was ranked
+// first.
+func rankingStats(values []string) (map[string]float64, map[string]int) {
+	sums := make(map[string]int)
+	counts := make(map[string]int)
+	firstPlace := make(map[string]int)
+	for _, value := range values {
+		ranked, ok := logic.MultiValues(value)
+		if !ok {
+			continue
+		}
+		for i, option := range ranked {
+			sums[option] += i + 1
+			counts[option]++
+		}
+		if len(ranked) > 0 {
+			firstPlace[ranked[0]]++
+		}
+	}
+
+	averages := make(map[string]float64, len(sums))
+	for option, sum := range sums {
+		averages[option] = float64(sum) / float64(counts[option])
+	}
+	return averages, firstPlace
+}
+
+// npsStats computes the Net Promoter Score: the percentage of promoters
+// (9 or 10) minus the percentage of detractors (0 to 6).
+func npsStats(values []string) map[string]interface{} {
+	var promoters, passives, detractors, sum int
+	for _, value := range values {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		switch {
+		case n >= 9:
+			promoters++
+		case n >= 7:
+			passives++
+		default:
+			detractors++
+		}
+		sum += n
+	}
+
+	stats := map[string]interface{}{
+		"promoters":  promoters,
+		"passives":   passives,
+		"detractors": detractors,
+	}
+	if total := promoters + passives + detractors; total > 0 {
+		stats["score"] = float64(promoters-detractors) * 100 / float64(total)
+		stats["average"] = float64(sum) / float64(total)
+	}
+	return stats
+}
+
+// exportColumns returns the CSV header cells of a question. Matrix questions
+// get a column per row and ranking questions a column per option holding its
+// rank; other questions get one column.
+func exportColumns(question models.Question) []string {
+	switch question.Type {
+	case "matrix":
+		columns := make([]string, 0, len(question.Rows))
+		for _, row := range question.Rows {
+			columns = append(columns, fmt.Sprintf("%s [%s]", question.Text, rowLabel(row)))
+		}
+		return columns
+	case "ranking":
+		columns := make([]string, 0, len(question.Options))
+		for _, option := range question.Options {
+			columns = append(columns, fmt.Sprintf("%s [%s]", question.Text, optionLabel(option)))
+		}
+		return columns
+	}
+	return []string{question.Text}
+}
+
+// exportCells returns the CSV cells of an answer, matching exportColumns.
+// Several columns selected in a matrix row are separated by "; ".
+func exportCells(question models.Question, value string) []string {
+	switch question.Type {
+	case "matrix":
+		rows, _ := validation.DecodeMatrix(value)
+		cells := make([]string, 0, len(question.Rows))
+		for _, row := range question.Rows {
+			cells = append(cells, strings.Join(rows[validation.RowValue(row)], "; "))
+		}
+		return cells
+	case "ranking":
+		ranks := make(map[string]int)
+		if ranked, ok := logic.MultiValues(value); ok {
+			for i, option := range ranked {
+				ranks[option] = i + 1
+			}
+		}
+		cells := make([]string, 0, len(question.Options))
+		for _, option := range question.Options {
+			cell := ""
+			if rank, ok := ranks[validation.OptionValue(option)]; ok {
+				cell = strconv.Itoa(rank)
+			}
+			cells = append(cells, cell)
+		}
+		return cells
+	}
+	return []string{value}
+}
+
+func rowLabel(row models.MatrixRow) string {
+	if row.Text != "" {
+		return row.Text
+	}
+	return row.Value
+}
+
+func optionLabel(option models.Option) string {
+	if option.Text != "" {
+		return option.Text
+	}
+	return option.Value
+}
+
 func ExportSurveyData(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	surveyID, err := strconv.ParseUint(vars["id"], 10, 64)
@@ -93,36 +359,80 @@ func ExportSurveyData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID := r.Context().Value("userID").(uint)
 	var survey models.Survey
-	if err := db.DB.Preload("Questions").Preload("Responses.Answers").First(&survey, surveyID).Error; err != nil {
+	if err := authz.Survey(db.DB.Preload("Questions.Options").Preload("Questions.Rows").Preload("Responses", "status = ?", responseCompleted).Preload("Responses.Answers"), userID, uint(surveyID), authz.ActionExportResponses, &survey); err != nil {
 		http.Error(w, "Survey not found", http.StatusNotFound)
 		return
 	}
 
+	if mfaRequiredForExport() {
+		var user models.User
+		if err := db.DB.Select("id", "mfa_enabled_at").First(&user, userID).Error; err != nil || user.MFAEnabledAt == nil {
+			http.Error(w, "Two-factor authentication is required to export responses", http.StatusForbidden)
+			return
+		}
+	}
+
+	// Old responses keep the columns of the version they answered.
+	questions, questionVersions, err := answeredQuestions(db.DB, &survey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	survey.Questions = questions
+
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", "attachment;filename=survey_data.csv")
 
 	csvWriter := csv.NewWriter(w)
 
 	// Write header
-	header := []string{"ResponseID", "Timestamp"}
+	header := []string{"ResponseID", "Timestamp", "Version"}
+	// When the export spans several versions, each column is marked with its
+	// version, such as "Rating (v2)", so an edited question does not get
+	// identical headers.
+	versions := make(map[int]bool)
+	for _, v := range questionVersions {
+		versions[v] = true
+	}
 	for _, question := range survey.Questions {
-		header = append(header, question.Text)
+		columns := exportColumns(question)
+		if len(versions) > 1 {
+			for i := range columns {
+				columns[i] = fmt.Sprintf("%s (v%d)", columns[i], questionVersions[question.ID])
+			}
+		}
+		header = append(header, columns...)
 	}
+	header = append(header, "DisplayOrder")
 	csvWriter.Write(header)
 
 	// Write data
 	for _, response := range survey.Responses {
-		row := []string{strconv.Itoa(int(response.ID)), response.CreatedAt.String()}
+		submittedAt := response.CreatedAt
+		if response.CompletedAt != nil {
+			submittedAt = *response.CompletedAt
+		}
+		row := []string{strconv.Itoa(int(response.ID)), submittedAt.String(), strconv.Itoa(response.Version)}
 		answerMap := make(map[uint]string)
 		for _, answer := range response.Answers {
 			answerMap[answer.QuestionID] = answer.Value
 		}
 		for _, question := range survey.Questions {
-			row = append(row, answerMap[question.ID])
+			row = append(row, exportCells(question, answerMap[question.ID])...)
 		}
+		row = append(row, response.DisplayOrder)
 		csvWriter.Write(row)
 	}
 
 	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		log.Printf("Error exporting survey %d: %v", survey.ID, err)
+		return
+	}
+
+	if err := webhooks.Publish(db.DB, survey.ID, webhooks.EventExportCompleted, exportCompletedData(survey.ID, len(survey.Responses), userID)); err != nil {
+		log.Printf("Error queueing export webhook for survey %d: %v", survey.ID, err)
+	}
 }
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestQuestionTypeAnalytics(t *testing.T) {
+	matrix := models.Question{
+		Model:   gorm.Model{ID: 1},
+		Text:    "Rate us",
+		Type:    "matrix",
+		Rows:    []models.MatrixRow{{Text: "Price", Value: "price"}, {Text: "Support", Value: "support"}},
+		Options: []models.Option{{Value: "bad"}, {Value: "good"}},
+	}
+	ranking := models.Question{
+		Model:   gorm.Model{ID: 2},
+		Text:    "Rank",
+		Type:    "ranking",
+		Options: []models.Option{{Text: "A", Value: "a"}, {Text: "B", Value: "b"}, {Text: "C", Value: "c"}},
+	}
+	nps := models.Question{Model: gorm.Model{ID: 3}, Text: "Recommend?", Type: "nps"}
+	number := models.Question{Model: gorm.Model{ID: 4}, Text: "Age", Type: "number"}
+	date := models.Question{Model: gorm.Model{ID: 5}, Text: "When", Type: "date"}
+
+	answers := [][]string{
+		{`{"price":"bad","support":"good"}`, `["a","b","c"]`, "10", "30", "2024-03-01"},
+		{`{"price":"good"}`, `["b","a","c"]`, "8", "40.5", "2023-12-24"},
+		{`{"price":"good","support":"good"}`, `["a","c","b"]`, "3", "", "2024-01-15"},
+	}
+	survey := models.Survey{Questions: []models.Question{matrix, ranking, nps, number, date}}
+	for _, values := range answers {
+		var response models.Response
+		for i, value := range values {
+			response.Answers = append(response.Answers, models.Answer{QuestionID: uint(i + 1), Value: value})
+		}
+		survey.Responses = append(survey.Responses, response)
+	}
+
+	questions := calculateAnalytics(&survey)["questionAnalytics"].(map[string]interface{})
+
+	assert.Equal(t, map[string]map[string]int{
+		"price":   {"bad": 1, "good": 2},
+		"support": {"good": 2},
+	}, questions["1"].(map[string]interface{})["rowCounts"])
+
+	rank := questions["2"].(map[string]interface{})
+	assert.InDelta(t, 4.0/3, rank["averageRank"].(map[string]float64)["a"], 1e-9)
+	assert.InDelta(t, 8.0/3, rank["averageRank"].(map[string]float64)["c"], 1e-9)
+	assert.Equal(t, map[string]int{"a": 2, "b": 1}, rank["firstPlaceCounts"])
+
+	score := questions["3"].(map[string]interface{})
+	assert.Equal(t, 1, score["promoters"])
+	assert.Equal(t, 1, score["passives"])
+	assert.Equal(t, 1, score["detractors"])
+	assert.InDelta(t, 0.0, score["score"], 1e-9)
+
+	numbers := questions["4"].(map[string]interface{})
+	assert.Equal(t, 30.0, numbers["min"])
+	assert.Equal(t, 40.5, numbers["max"])
+	assert.Equal(t, 35.25, numbers["average"])
+
+	dates := questions["5"].(map[string]interface{})
+	assert.Equal(t, "2023-12-24", dates["earliest"])
+	assert.Equal(t, "2024-03-01", dates["latest"])
+}
+
+func TestExportColumns(t *testing.T) {
+	matrix := models.Question{
+		Text:          "Rate us",
+		Type:          "matrix",
+		AllowMultiple: true,
+		Rows:          []models.MatrixRow{{Text: "Price", Value: "price"}, {Value: "support"}},
+	}
+	assert.Equal(t, []string{"Rate us [Price]", "Rate us [support]"}, exportColumns(matrix))
+	assert.Equal(t, []string{"bad; ok", ""}, exportCells(matrix, `{"price":["bad","ok"]}`))
+
+	ranking := models.Question{
+		Text:    "Rank",
+		Type:    "ranking",
+		Options: []models.Option{{Text: "A", Value: "a"}, {Text: "B", Value: "b"}, {Text: "C", Value: "c"}},
+	}
+	assert.Equal(t, []string{"Rank [A]", "Rank [B]", "Rank [C]"}, exportColumns(ranking))
+	assert.Equal(t, []string{"2", "", "1"}, exportCells(ranking, `["c","a"]`))
+	assert.Equal(t, []string{"", "", ""}, exportCells(ranking, ""))
+
+	email := models.Question{Text: "Email", Type: "email"}
+	assert.Equal(t, []string{"Email"}, exportColumns(email))
+	assert.Equal(t, []string{"ada@example.com"}, exportCells(email, "ada@example.com"))
+}
@@ -1,69 +1,130 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/nikhilsahni7/SurveyX/auth"
+	"github.com/nikhilsahni7/SurveyX/auth/oidc"
 	"github.com/nikhilsahni7/SurveyX/config"
 	"github.com/nikhilsahni7/SurveyX/db"
 	"github.com/nikhilsahni7/SurveyX/models"
 )
 
+// oidcFlowTimeout is how long a user has to finish logging in at the provider.
+const oidcFlowTimeout = 10 * time.Minute
+
+// LoginHandler starts an OIDC login with the provider named in the URL. The
+// state, nonce and PKCE verifier are kept in the session until the callback.
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("LoginHandler called. GoogleOauthConfig: %+v", config.GoogleOauthConfig)
-	if config.GoogleOauthConfig.ClientID == "" || config.GoogleOauthConfig.ClientSecret == "" {
-		log.Println("Error: Google OAuth ClientID or ClientSecret is empty")
-		http.Error(w, "OAuth configuration error", http.StatusInternalServerError)
+	name := mux.Vars(r)["provider"]
+	provider, ok := config.OIDCProviders[name]
+	if !ok {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	state, nonce, verifier := oidc.NewFlow()
+	url, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("Error starting %s login: %v", name, err)
+		http.Error(w, "Login provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	session, _ := auth.Store.Get(r, "session-name")
+	session.Values["oidc_provider"] = name
+	session.Values["oidc_state"] = state
+	session.Values["oidc_nonce"] = nonce
+	session.Values["oidc_verifier"] = verifier
+	session.Values["oidc_started_at"] = time.Now().Unix()
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, "Failed to save session", http.StatusInternalServerError)
 		return
 	}
 
-	state := config.GenerateStateOauthCookie(w)
-	url := config.GoogleOauthConfig.AuthCodeURL(state)
-	log.Printf("Redirecting to Google OAuth URL: %s", url)
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
-func GoogleCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	if err := config.VerifyStateOauthCookie(r); err != nil {
-		http.Error(w, "Invalid OAuth state: "+err.Error(), http.StatusBadRequest)
+// OAuthCallbackHandler finishes an OIDC login: it checks the state, redeems
+// the code, verifies the ID token and signs in the user the identity belongs
+// to.
+func OAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["provider"]
+	provider, ok := config.OIDCProviders[name]
+	if !ok {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
 		return
 	}
 
-	code := r.FormValue("code")
-	token, err := config.GoogleOauthConfig.Exchange(r.Context(), code)
+	session, err := auth.Store.Get(r, "session-name")
 	if err != nil {
-		http.Error(w, "Failed to exchange token: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Invalid OAuth state", http.StatusBadRequest)
 		return
 	}
+	flowProvider, _ := session.Values["oidc_provider"].(string)
+	state, _ := session.Values["oidc_state"].(string)
+	nonce, _ := session.Values["oidc_nonce"].(string)
+	verifier, _ := session.Values["oidc_verifier"].(string)
+	startedAt, _ := session.Values["oidc_started_at"].(int64)
+	for _, key := range []string{"oidc_provider", "oidc_state", "oidc_nonce", "oidc_verifier", "oidc_started_at"} {
+		delete(session.Values, key)
+	}
 
-	user, err := auth.GetGoogleUserInfo(token.AccessToken)
-	if err != nil {
-		http.Error(w, "Failed to get user info: "+err.Error(), http.StatusInternalServerError)
+	if flowProvider != name || state == "" ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(r.FormValue("state"))) != 1 ||
+		time.Since(time.Unix(startedAt, 0)) > oidcFlowTimeout {
+		session.Save(r, w)
+		http.Error(w, "Invalid OAuth state", http.StatusBadRequest)
+		return
+	}
+	if providerErr := r.FormValue("error"); providerErr != "" {
+		session.Save(r, w)
+		http.Error(w, "Login failed: "+providerErr, http.StatusBadRequest)
 		return
 	}
 
-	err = auth.CreateOrUpdateUser(user)
+	claims, err := provider.Exchange(r.Context(), r.FormValue("code"), verifier, nonce)
 	if err != nil {
-		http.Error(w, "Failed to create/update user: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error finishing %s login: %v", name, err)
+		session.Save(r, w)
+		http.Error(w, "Failed to verify login", http.StatusUnauthorized)
 		return
 	}
 
-	session, err := auth.Store.New(r, "session-name")
-	if err != nil {
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+	user, err := auth.LoginWithIdentity(&auth.ExternalIdentity{
+		Provider:      name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+	})
+	if errors.Is(err, auth.ErrIdentityConflict) {
+		session.Save(r, w)
+		http.Error(w, err.Error(), http.StatusConflict)
 		return
 	}
-	session.Values["authenticated"] = true
-	session.Values["user_id"] = user.ID
-	err = session.Save(r, w)
 	if err != nil {
+		session.Save(r, w)
+		http.Error(w, "Failed to create/update user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	acceptPendingInvitations(user)
+
+	if err := auth.StartSession(w, r, session, user.ID, clientIP(r)); err != nil {
 		http.Error(w, "Failed to save session", http.StatusInternalServerError)
 		return
 	}
 
-	http.Redirect(w, r, "http://localhost:3000/dashboard", http.StatusSeeOther)
+	http.Redirect(w, r, frontendURL()+"/dashboard", http.StatusSeeOther)
 }
 
 func RegisterHandler(w http.ResponseWriter, r *http.Request) {
@@ -77,12 +138,22 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if len(user.Password) < minPasswordLength {
+		http.Error(w, fmt.Sprintf("Password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
 
 	newUser, err := auth.CreateUser(user.Email, user.Name, user.Password)
 	if err != nil {
 		http.Error(w, "Error creating user: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// The address of a password signup is not verified yet, so its
+	// invitations stay pending until it is; the invitation link still works.
+	acceptPendingInvitations(newUser)
+	if err := sendVerificationEmail(r.Context(), newUser); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", newUser.ID, err)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -100,26 +171,67 @@ func LoginHandlerEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := auth.GetUserByEmail(credentials.Email)
-	if err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	email := strings.TrimSpace(credentials.Email)
+	attempt := reserveLoginAttempt(w, r, email)
+	if attempt == nil {
 		return
 	}
 
-	if !auth.CheckPasswordHash(credentials.Password, user.PasswordHash) {
+	// Unknown emails go through the same password check, against a dummy
+	// hash, so they cannot be told apart by the response or its timing.
+	user, err := auth.GetUserByEmail(email)
+	hash := ""
+	if err == nil {
+		hash = user.PasswordHash
+	} else {
+		user = nil
+	}
+	if !auth.CheckPasswordOrDummy(credentials.Password, hash) {
+		recordLoginFailure(r, attempt, email, user, loginInvalidCredentials)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
+	if emailVerificationRequired() && user.EmailVerifiedAt == nil {
+		// The password was right, so this does not count as a failure.
+		if err := attempt.Release(); err != nil {
+			log.Printf("Error releasing login attempt: %v", err)
+		}
+		auditLogin(r, email, user, false, loginEmailNotVerified)
+		http.Error(w, "Email address has not been verified", http.StatusForbidden)
+		return
+	}
+
+	if err := attempt.Succeed(); err != nil {
+		log.Printf("Error clearing failed logins: %v", err)
+	}
+
 	session, err := auth.Store.New(r, "session-name")
 	if err != nil {
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
-	session.Values["authenticated"] = true
-	session.Values["user_id"] = user.ID
-	err = session.Save(r, w)
-	if err != nil {
+
+	// With two-factor authentication the session stays unauthenticated until
+	// LoginMFAHandler accepts a code.
+	if user.MFAEnabledAt != nil {
+		auditLogin(r, email, user, true, loginMFARequired)
+		session.Values["authenticated"] = false
+		session.Values["pending_mfa"] = user.ID
+		session.Values["pending_mfa_at"] = time.Now().Unix()
+		if err := session.Save(r, w); err != nil {
+			http.Error(w, "Failed to save session", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":     "Two-factor authentication code required",
+			"mfaRequired": true,
+		})
+		return
+	}
+
+	auditLogin(r, email, user, true, loginSucceeded)
+	if err := auth.StartSession(w, r, session, user.ID, clientIP(r)); err != nil {
 		http.Error(w, "Failed to save session", http.StatusInternalServerError)
 		return
 	}
@@ -134,6 +246,11 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	token, _ := session.Values["sid"].(string)
+	if err := auth.EndSession(token); err != nil {
+		log.Printf("Error revoking session: %v", err)
+	}
+
 	session.Values = make(map[interface{}]interface{})
 	session.Options.MaxAge = -1
 
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"gorm.io/gorm"
+)
+
+// Reasons reported when a survey cannot be accessed or answered.
+const (
+	reasonUnpublished  = "unpublished"
+	reasonNotYetOpen   = "not_yet_open"
+	reasonClosed       = "closed"
+	reasonLimitReached = "response_limit_reached"
+)
+
+var unavailableStatus = map[string]int{
+	reasonUnpublished:  http.StatusForbidden,
+	reasonNotYetOpen:   http.StatusForbidden,
+	reasonClosed:       http.StatusGone,
+	reasonLimitReached: http.StatusGone,
+}
+
+// surveyUnavailableError is returned by checkAvailability when respondents may
+// not see or answer a survey.
+type surveyUnavailableError struct {
+	Reason  string
+	Survey  *models.Survey
+	OpensAt *time.Time
+}
+
+func (e *surveyUnavailableError) Error() string {
+	return "survey unavailable: " + e.Reason
+}
+
+// checkAvailability decides whether a survey is open to respondents at now.
+// It is the single check used by both the public access and submission
+// endpoints. To keep the response limit exact under concurrent submissions,
+// callers that go on to insert a response must run it inside the inserting
+// transaction after locking the survey row.
+func checkAvailability(tx *gorm.DB, survey *models.Survey, now time.Time) error {
+	if err := checkOpen(survey, now); err != nil {
+		return err
+	}
+
+	if survey.ResponseLimit != nil {
+		var count int64
+		if err := tx.Model(&models.Response{}).Where("survey_id = ? AND status = ?", survey.ID, responseCompleted).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= int64(*survey.ResponseLimit) {
+			return &surveyUnavailableError{Reason: reasonLimitReached, Survey: survey}
+		}
+	}
+
+	return nil
+}
+
+// checkOpen is checkAvailability without the response limit. Respondents
+// with a draft keep saving answers once the limit is reached, only submitting
+// is refused.
+func checkOpen(survey *models.Survey, now time.Time) error {
+	if !survey.IsPublished {
+		return &surveyUnavailableError{Reason: reasonUnpublished, Survey: survey}
+	}
+	if survey.ReleaseDate != nil && now.Before(*survey.ReleaseDate) {
+		return &surveyUnavailableError{Reason: reasonNotYetOpen, Survey: survey, OpensAt: survey.ReleaseDate}
+	}
+	if survey.CloseDate != nil && !now.Before(*survey.CloseDate) {
+		return &surveyUnavailableError{Reason: reasonClosed, Survey: survey}
+	}
+	return nil
+}
+
+// writeAvailabilityError responds with the reason a survey is unavailable and
+// its ClosedMessage, or with 500 for any other error.
+func writeAvailabilityError(w http.ResponseWriter, err error) {
+	var unavailable *surveyUnavailableError
+	if !errors.As(err, &unavailable) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body := map[string]interface{}{
+		"error":  "Survey is not available",
+		"reason": unavailable.Reason,
+	}
+	if unavailable.Survey.ClosedMessage != "" {
+		body["message"] = unavailable.Survey.ClosedMessage
+	}
+	if unavailable.OpensAt != nil {
+		body["opensAt"] = unavailable.OpensAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(unavailableStatus[unavailable.Reason])
+	json.NewEncoder(w).Encode(body)
+}
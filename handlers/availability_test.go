@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/nikhilsahni7/SurveyX/webhooks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestSurveyAvailability(t *testing.T) {
+	testDB := setupTestDB()
+	db.DB = testDB
+	defer func() {
+		sqlDB, _ := testDB.DB()
+		sqlDB.Close()
+	}()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/surveys/{id}/responses", SubmitResponse).Methods("POST")
+	router.HandleFunc("/surveys/link/{linkID}", AccessSurveyByLink).Methods("GET")
+
+	user := createTestUser(t, "availability")
+	now := time.Now()
+
+	// createSurvey stores a survey without questions and a link to it.
+	createSurvey := func(t *testing.T, survey models.Survey) (models.Survey, string) {
+		survey.UserID = user.ID
+		survey.Title = "Test Survey for Availability"
+		require.NoError(t, db.DB.Create(&survey).Error)
+		link := models.SurveyLink{SurveyID: survey.ID, Link: fmt.Sprintf("availability-%d", survey.ID), IsActive: true}
+		require.NoError(t, db.DB.Create(&link).Error)
+		return survey, link.Link
+	}
+	submit := func(surveyID uint) int {
+		return serveAs(router, "POST", fmt.Sprintf("/surveys/%d/responses", surveyID), map[string]interface{}{"answers": []interface{}{}}, 0).Code
+	}
+	// expectUnavailable checks that both the link and submissions report
+	// reason with status.
+	expectUnavailable := func(t *testing.T, survey models.Survey, link string, status int, reason string) map[string]interface{} {
+		rr := serveAs(router, "GET", "/surveys/link/"+link, nil, 0)
+		assert.Equal(t, status, rr.Code)
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Equal(t, reason, body["reason"])
+
+		assert.Equal(t, status, submit(survey.ID))
+		return body
+	}
+
+	t.Run("Unpublished", func(t *testing.T) {
+		survey, link := createSurvey(t, models.Survey{IsPublished: false})
+		expectUnavailable(t, survey, link, http.StatusForbidden, reasonUnpublished)
+	})
+
+	t.Run("NotYetOpen", func(t *testing.T) {
+		opensAt := now.Add(time.Hour).Truncate(time.Second)
+		survey, link := createSurvey(t, models.Survey{IsPublished: true, ReleaseDate: &opensAt})
+		body := expectUnavailable(t, survey, link, http.StatusForbidden, reasonNotYetOpen)
+
+		reported, err := time.Parse(time.RFC3339, body["opensAt"].(string))
+		require.NoError(t, err)
+		assert.True(t, opensAt.Equal(reported))
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		closedAt := now.Add(-time.Hour)
+		survey, link := createSurvey(t, models.Survey{IsPublished: true, CloseDate: &closedAt, ClosedMessage: "Thanks, this survey has ended."})
+		body := expectUnavailable(t, survey, link, http.StatusGone, reasonClosed)
+		assert.Equal(t, "Thanks, this survey has ended.", body["message"])
+	})
+
+	t.Run("ResponseLimitReached", func(t *testing.T) {
+		limit := 1
+		survey, link := createSurvey(t, models.Survey{IsPublished: true, ResponseLimit: &limit})
+		assert.Equal(t, http.StatusCreated, submit(survey.ID))
+		expectUnavailable(t, survey, link, http.StatusGone, reasonLimitReached)
+	})
+
+	// Test that concurrent submissions never go over the limit
+	t.Run("ConcurrentResponseLimit", func(t *testing.T) {
+		limit := 3
+		survey, _ := createSurvey(t, models.Survey{IsPublished: true, ResponseLimit: &limit})
+
+		var mu sync.Mutex
+		codes := make(map[int]int)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				code := submit(survey.ID)
+				mu.Lock()
+				codes[code]++
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, map[int]int{http.StatusCreated: 3, http.StatusGone: 7}, codes)
+		var count int64
+		require.NoError(t, db.DB.Model(&models.Response{}).Where("survey_id = ? AND status = ?", survey.ID, responseCompleted).Count(&count).Error)
+		assert.Equal(t, int64(3), count)
+	})
+	// Test that survey.closed is queued once when the close date passes, and
+	// not again after the limit fills
+	t.Run("ClosedEvent", func(t *testing.T) {
+		closeDate := now.Add(time.Minute)
+		limit := 1
+		survey, _ := createSurvey(t, models.Survey{IsPublished: true, CloseDate: &closeDate, ResponseLimit: &limit})
+		hook := models.Webhook{UserID: user.ID, SurveyID: survey.ID, URL: "https://example.com/hook", Events: models.EventList{string(webhooks.EventSurveyClosed)}}
+		require.NoError(t, db.DB.Create(&hook).Error)
+		closedEvents := func() int64 {
+			var count int64
+			require.NoError(t, db.DB.Model(&models.WebhookDelivery{}).Where("webhook_id = ? AND event = ?", hook.ID, webhooks.EventSurveyClosed).Count(&count).Error)
+			return count
+		}
+
+		_, err := closePastSurveys(db.DB, now)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), closedEvents())
+
+		_, err = closePastSurveys(db.DB, closeDate)
+		require.NoError(t, err)
+		_, err = closePastSurveys(db.DB, closeDate.Add(time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), closedEvents())
+
+		require.NoError(t, db.DB.Transaction(func(tx *gorm.DB) error {
+			return publishSurveyClosed(tx, survey.ID, time.Now())
+		}))
+		assert.Equal(t, int64(1), closedEvents())
+	})
+}
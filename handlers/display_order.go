@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/nikhilsahni7/SurveyX/logic"
+)
+
+// seedCookie identifies a respondent's browser so shuffled surveys are shown
+// in the same order when the page is reloaded.
+const seedCookie = "survey_seed"
+
+// maxSeedLength bounds seeds chosen by clients.
+const maxSeedLength = 64
+
+// respondentSeed returns the shuffle seed of the respondent: the seed query
+// parameter, for clients that keep it themselves, or the seed cookie. A new
+// seed is issued in the cookie if there is neither.
+func respondentSeed(w http.ResponseWriter, r *http.Request) (string, error) {
+	if seed := r.URL.Query().Get("seed"); seed != "" && len(seed) <= maxSeedLength {
+		return seed, nil
+	}
+	if cookie, err := r.Cookie(seedCookie); err == nil && cookie.Value != "" && len(cookie.Value) <= maxSeedLength {
+		return cookie.Value, nil
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	seed := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     seedCookie,
+		Value:    seed,
+		Path:     "/",
+		MaxAge:   86400 * 365,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return seed, nil
+}
+
+// submittedSeed returns the seed a submission was shown with, from the
+// request body or the seed cookie, or "" if it is unknown.
+func submittedSeed(r *http.Request, fromBody string) string {
+	if fromBody != "" && len(fromBody) <= maxSeedLength {
+		return fromBody
+	}
+	if cookie, err := r.Cookie(seedCookie); err == nil && len(cookie.Value) <= maxSeedLength {
+		return cookie.Value
+	}
+	return ""
+}
+
+// encodeOrder encodes order for models.Response.DisplayOrder.
+func encodeOrder(order logic.Order) (string, error) {
+	encoded, err := json.Marshal(order)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// decodeOrder decodes models.Response.DisplayOrder. Responses recorded
+// without an order decode to an empty one, which leaves the survey order
+// unchanged.
+func decodeOrder(encoded string) logic.Order {
+	var order logic.Order
+	if encoded != "" {
+		json.Unmarshal([]byte(encoded), &order)
+	}
+	return order
+}
@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/auth"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/logic"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/nikhilsahni7/SurveyX/validation"
+	"github.com/nikhilsahni7/SurveyX/webhooks"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Response statuses, see models.Response.
+const (
+	responseDraft     = "draft"
+	responseCompleted = "completed"
+	responseAbandoned = "abandoned"
+)
+
+// resumeTokenHeader carries the token of a draft response. It is not part of
+// the URL so it does not end up in access logs.
+const resumeTokenHeader = "X-Resume-Token"
+
+var (
+	errDraftNotFound = errors.New("draft response not found")
+	errDraftExpired  = errors.New("draft response has expired")
+)
+
+// draftTTL is how long a draft can go without being saved before it is
+// abandoned, from RESPONSE_DRAFT_TTL_HOURS (default 7 days).
+func draftTTL() time.Duration {
+	if hours, err := strconv.Atoi(os.Getenv("RESPONSE_DRAFT_TTL_HOURS")); err == nil && hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+type draftAnswer struct {
+	QuestionID uint   `json:"questionId"`
+	Value      string `json:"value"`
+}
+
+// draftView is what respondents get back for a draft. Pages are those of the
+// survey version the draft was started on, so a draft can be finished even if
+// the survey is edited meanwhile. NextSectionID and Finished answer a save
+// that completed a page: the page to show next, or the end of the survey.
+type draftView struct {
+	ID            uint          `json:"id"`
+	SurveyID      uint          `json:"surveyId"`
+	Version       int           `json:"version"`
+	ResumeToken   string        `json:"resumeToken,omitempty"`
+	ExpiresAt     *time.Time    `json:"expiresAt"`
+	Answers       []draftAnswer `json:"answers"`
+	Pages         []logic.Page  `json:"pages"`
+	Logic         []logic.Rule  `json:"logic"`
+	NextSectionID *uint         `json:"nextSectionId,omitempty"`
+	Finished      bool          `json:"finished,omitempty"`
+}
+
+func newDraftView(response *models.Response, version *versionView) draftView {
+	view := draftView{
+		ID:        response.ID,
+		SurveyID:  response.SurveyID,
+		Version:   response.Version,
+		ExpiresAt: response.ExpiresAt,
+		Answers:   make([]draftAnswer, 0, len(response.Answers)),
+		Pages:     logic.ApplyOrder(logic.Pages(version.Sections, version.Questions), decodeOrder(response.DisplayOrder)),
+		Logic:     logic.Rules(version.Questions),
+	}
+	for _, a := range response.Answers {
+		view.Answers = append(view.Answers, draftAnswer{QuestionID: a.QuestionID, Value: a.Value})
+	}
+	return view
+}
+
+// StartDraftResponse starts a response that is saved as it is filled in. The
+// resume token in the reply is needed to save, resume and submit it.
+func StartDraftResponse(w http.ResponseWriter, r *http.Request) {
+	surveyID := parseUintParam(r, "id")
+
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	seed, err := respondentSeed(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().Add(draftTTL())
+	response := models.Response{
+		SurveyID:        surveyID,
+		IP:              r.RemoteAddr,
+		UserAgent:       r.UserAgent(),
+		Status:          responseDraft,
+		ResumeTokenHash: hash,
+		ExpiresAt:       &expiresAt,
+	}
+
+	var version *versionView
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var locked models.Survey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, surveyID).Error; err != nil {
+			return err
+		}
+		if err := checkAvailability(tx, &locked, time.Now()); err != nil {
+			return err
+		}
+
+		// Pin the draft to the current revision.
+		if err := snapshotSurvey(tx, &locked); err != nil {
+			return err
+		}
+		response.Version = locked.Version
+		var err error
+		version, err = loadVersion(tx, surveyID, locked.Version)
+		if err != nil {
+			return err
+		}
+
+		// The order is fixed when the draft starts, so it stays the same
+		// when the draft is resumed on another device.
+		response.DisplayOrder, err = encodeOrder(logic.Shuffle(logic.Pages(version.Sections, version.Questions), seed))
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&response).Error
+	}); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Survey not found", http.StatusNotFound)
+			return
+		}
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	view := newDraftView(&response, version)
+	view.ResumeToken = token
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(view)
+}
+
+// GetDraftResponse returns a draft with its answers so far.
+func GetDraftResponse(w http.ResponseWriter, r *http.Request) {
+	response, err := findDraft(db.DB, parseUintParam(r, "id"), r.Header.Get(resumeTokenHeader))
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	version, err := loadVersion(db.DB, response.SurveyID, response.Version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newDraftView(response, version))
+}
+
+// SaveDraftAnswers saves some answers of a draft. Each answer is validated
+// against its question; an empty value clears the answer. Saving keeps the
+// draft from expiring.
+//
+// With completeSectionId (0 for surveys without sections) the respondent
+// finishes that page: it is validated as a whole once the answers are saved,
+// and the reply tells which page comes next. Nothing is saved if the page
+// fails validation.
+func SaveDraftAnswers(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Answers           []draftAnswer `json:"answers"`
+		CompleteSectionID *uint         `json:"completeSectionId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	answers := make([]models.Answer, 0, len(input.Answers))
+	for _, a := range input.Answers {
+		answers = append(answers, models.Answer{QuestionID: a.QuestionID, Value: a.Value})
+	}
+
+	surveyID := parseUintParam(r, "id")
+	token := r.Header.Get(resumeTokenHeader)
+	var response *models.Response
+	var version *versionView
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		response, err = findDraft(tx.Clauses(clause.Locking{Strength: "UPDATE"}), surveyID, token)
+		if err != nil {
+			return err
+		}
+		var survey models.Survey
+		if err := tx.First(&survey, surveyID).Error; err != nil {
+			return err
+		}
+		if err := checkOpen(&survey, time.Now()); err != nil {
+			return err
+		}
+		version, err = loadVersion(tx, surveyID, response.Version)
+		if err != nil {
+			return err
+		}
+
+		if err := validation.ValidateAnswers(version.Questions, answers); err != nil {
+			return err
+		}
+
+		questionTypes := make(map[uint]string, len(version.Questions))
+		for _, q := range version.Questions {
+			questionTypes[q.ID] = q.Type
+		}
+		for _, a := range answers {
+			if err := tx.Unscoped().Where("response_id = ? AND question_id = ?", response.ID, a.QuestionID).Delete(&models.Answer{}).Error; err != nil {
+				return err
+			}
+			if logic.IsEmptyAnswer(questionTypes[a.QuestionID], a.Value) {
+				continue
+			}
+			a.ResponseID = response.ID
+			if err := tx.Create(&a).Error; err != nil {
+				return err
+			}
+		}
+
+		expiresAt := time.Now().Add(draftTTL())
+		response.ExpiresAt = &expiresAt
+		if err := tx.Model(response).Update("expires_at", expiresAt).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("response_id = ?", response.ID).Find(&response.Answers).Error; err != nil {
+			return err
+		}
+
+		if input.CompleteSectionID != nil {
+			return validation.ValidatePage(version.Sections, version.Questions, *input.CompleteSectionID, response.Answers)
+		}
+		return nil
+	})
+	if err != nil {
+		var validationErr *validation.Error
+		var unavailable *surveyUnavailableError
+		switch {
+		case errors.As(err, &validationErr):
+			writeValidationError(w, err)
+		case errors.As(err, &unavailable):
+			writeAvailabilityError(w, err)
+		case errors.Is(err, validation.ErrPageNotReached):
+			http.Error(w, "Section is not on the respondent's path", http.StatusConflict)
+		default:
+			writeDraftError(w, err)
+		}
+		return
+	}
+
+	view := newDraftView(response, version)
+	if input.CompleteSectionID != nil {
+		values := make(map[uint]string, len(response.Answers))
+		for _, a := range response.Answers {
+			values[a.QuestionID] = a.Value
+		}
+		current := 0
+		for i, page := range view.Pages {
+			if page.SectionID == *input.CompleteSectionID {
+				current = i
+			}
+		}
+		if next, ok := logic.NextPage(view.Pages, values, current); ok {
+			view.NextSectionID = &view.Pages[next].SectionID
+		} else {
+			view.Finished = true
+		}
+	}
+	json.NewEncoder(w).Encode(view)
+}
+
+// SubmitDraftResponse validates a draft as a complete response and turns it
+// into one. Answers to questions the survey logic hides, or on pages the page
+// rules skip, are dropped first, since respondents may change an answer that
+// hides questions they already answered.
+func SubmitDraftResponse(w http.ResponseWriter, r *http.Request) {
+	surveyID := parseUintParam(r, "id")
+	token := r.Header.Get(resumeTokenHeader)
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the survey row first, like SubmitResponse, so the response
+		// limit is checked one submission at a time.
+		var locked models.Survey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, surveyID).Error; err != nil {
+			return err
+		}
+
+		response, err := findDraft(tx.Clauses(clause.Locking{Strength: "UPDATE"}), surveyID, token)
+		if err != nil {
+			return err
+		}
+		if err := checkAvailability(tx, &locked, time.Now()); err != nil {
+			return err
+		}
+
+		version, err := loadVersion(tx, surveyID, response.Version)
+		if err != nil {
+			return err
+		}
+
+		values := make(map[uint]string, len(response.Answers))
+		for _, a := range response.Answers {
+			values[a.QuestionID] = a.Value
+		}
+		visible := logic.VisibleOnPath(logic.Pages(version.Sections, version.Questions), values)
+		answers := make([]models.Answer, 0, len(response.Answers))
+		for _, a := range response.Answers {
+			if visible[a.QuestionID] {
+				answers = append(answers, a)
+				continue
+			}
+			if err := tx.Unscoped().Delete(&models.Answer{}, a.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := validation.ValidateSurveyResponse(version.Sections, version.Questions, answers); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(response).Updates(map[string]interface{}{
+			"status":            responseCompleted,
+			"completed_at":      now,
+			"resume_token_hash": "",
+			"expires_at":        nil,
+		}).Error; err != nil {
+			return err
+		}
+		response.Answers = answers
+		return responseCompletedEvents(tx, &locked, response)
+	})
+	if err != nil {
+		var validationErr *validation.Error
+		var unavailable *surveyUnavailableError
+		switch {
+		case errors.As(err, &validationErr):
+			writeValidationError(w, err)
+		case errors.As(err, &unavailable):
+			writeAvailabilityError(w, err)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			http.Error(w, "Survey not found", http.StatusNotFound)
+		default:
+			writeDraftError(w, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Response submitted successfully"})
+}
+
+// findDraft loads the unexpired draft of surveyID that token resumes.
+func findDraft(tx *gorm.DB, surveyID uint, token string) (*models.Response, error) {
+	if token == "" {
+		return nil, errDraftNotFound
+	}
+
+	var response models.Response
+	err := tx.Where("survey_id = ? AND resume_token_hash = ? AND status = ?", surveyID, auth.HashToken(token), responseDraft).
+		Preload("Answers").First(&response).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errDraftNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if response.ExpiresAt != nil && !time.Now().Before(*response.ExpiresAt) {
+		return nil, errDraftExpired
+	}
+	return &response, nil
+}
+
+func writeDraftError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errDraftNotFound):
+		http.Error(w, "Draft response not found", http.StatusNotFound)
+	case errors.Is(err, errDraftExpired):
+		http.Error(w, "Draft response has expired", http.StatusGone)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// responseCompletedEvents queues the webhooks for a newly completed response,
+// and survey.closed if it filled the last slot of the response limit. survey
+// must be locked by the caller.
+func responseCompletedEvents(tx *gorm.DB, survey *models.Survey, response *models.Response) error {
+	if err := publishResponseEvent(tx, response, webhooks.EventResponseSubmitted); err != nil {
+		return err
+	}
+
+	if survey.ResponseLimit != nil {
+		var count int64
+		if err := tx.Model(&models.Response{}).Where("survey_id = ? AND status = ?", survey.ID, responseCompleted).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= int64(*survey.ResponseLimit) {
+			return publishSurveyClosed(tx, survey.ID, time.Now())
+		}
+	}
+	return nil
+}
+
+// abandonExpiredDrafts marks drafts that were not saved before they expired as
+// abandoned. Their answers are kept.
+func abandonExpiredDrafts(tx *gorm.DB, now time.Time) (int64, error) {
+	result := tx.Model(&models.Response{}).
+		Where("status = ? AND expires_at <= ?", responseDraft, now).
+		Updates(map[string]interface{}{"status": responseAbandoned, "resume_token_hash": ""})
+	return result.RowsAffected, result.Error
+}
+
+// closePastSurveys queues survey.closed for published surveys whose close
+// date has passed and returns how many it queued.
+func closePastSurveys(tx *gorm.DB, now time.Time) (int, error) {
+	var ids []uint
+	if err := tx.Model(&models.Survey{}).
+		Where("is_published = ? AND close_date <= ? AND closed_event_at IS NULL", true, now).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	closed := 0
+	for _, id := range ids {
+		if err := tx.Transaction(func(tx *gorm.DB) error {
+			return publishSurveyClosed(tx, id, now)
+		}); err != nil {
+			return closed, err
+		}
+		closed++
+	}
+	return closed, nil
+}
+
+// StartSweeper abandons expired drafts and queues survey.closed for surveys
+// past their close date every interval until ctx is done.
+func StartSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			n, err := abandonExpiredDrafts(db.DB, time.Now())
+			if err != nil {
+				log.Printf("Error abandoning expired draft responses: %v", err)
+			} else if n > 0 {
+				log.Printf("Abandoned %d expired draft responses", n)
+			}
+
+			closed, err := closePastSurveys(db.DB, time.Now())
+			if err != nil {
+				log.Printf("Error queueing survey.closed for past surveys: %v", err)
+			} else if closed > 0 {
+				log.Printf("Queued survey.closed for %d surveys past their close date", closed)
+			}
+		}
+	}()
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/auth"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"gorm.io/gorm"
+)
+
+// identityView is the API representation of a login method. The password
+// login is listed with provider "password" and no ID.
+type identityView struct {
+	ID          uint       `json:"id,omitempty"`
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email,omitempty"`
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+}
+
+func ListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uint)
+
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var identities []models.Identity
+	if err := db.DB.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]identityView, 0, len(identities)+1)
+	if user.PasswordHash != "" {
+		views = append(views, identityView{Provider: "password", Email: user.Email})
+	}
+	for i := range identities {
+		identity := &identities[i]
+		views = append(views, identityView{
+			ID:          identity.ID,
+			Provider:    identity.Provider,
+			Email:       identity.Email,
+			LastLoginAt: identity.LastLoginAt,
+			CreatedAt:   &identity.CreatedAt,
+		})
+	}
+	json.NewEncoder(w).Encode(views)
+}
+
+func UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	id := parseUintParam(r, "id")
+	userID := r.Context().Value("userID").(uint)
+
+	err := auth.UnlinkIdentity(userID, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Identity not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, auth.ErrLastLoginMethod) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nikhilsahni7/SurveyX/auth"
+	"github.com/nikhilsahni7/SurveyX/authz"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/mailer"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"gorm.io/gorm"
+)
+
+const (
+	invitationPending  = "pending"
+	invitationAccepted = "accepted"
+	invitationRevoked  = "revoked"
+	invitationExpired  = "expired"
+
+	invitationTTL = 7 * 24 * time.Hour
+)
+
+var errInvitationInvalid = errors.New("invitation is invalid or has expired")
+
+// inviteToTeam creates a pending invitation for an email address that has no
+// account yet. An existing pending invitation for the same team and email is
+// replaced so only the latest token works.
+func inviteToTeam(ctx context.Context, team *models.Team, email, role string, invitedBy uint) (*models.TeamInvitation, error) {
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := models.TeamInvitation{
+		TeamID:      team.ID,
+		Email:       normalizeEmail(email),
+		Role:        role,
+		TokenHash:   hash,
+		Status:      invitationPending,
+		ExpiresAt:   time.Now().Add(invitationTTL),
+		InvitedByID: invitedBy,
+	}
+
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.TeamInvitation{}).
+			Where("team_id = ? AND email = ? AND status = ?", team.ID, invitation.Email, invitationPending).
+			Update("status", invitationRevoked).Error; err != nil {
+			return err
+		}
+		return tx.Create(&invitation).Error
+	}); err != nil {
+		return nil, err
+	}
+
+	sendInvitation(ctx, team, &invitation, token)
+	return &invitation, nil
+}
+
+// sendInvitation mails the invitation token to the invitee.
+func sendInvitation(ctx context.Context, team *models.Team, invitation *models.TeamInvitation, token string) {
+	err := mailer.Send(ctx, mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You have been invited to join %s on SurveyX", team.Name),
+		Body: fmt.Sprintf("You have been invited to join the team %q on SurveyX as %s.\n\nAccept the invitation here:\n\n%s/invitations/accept?token=%s\n\nThe invitation expires on %s.\n",
+			team.Name, invitation.Role, frontendURL(), url.QueryEscape(token), invitation.ExpiresAt.Format("January 2, 2006")),
+	})
+	if err != nil {
+		log.Printf("Error sending invitation %d: %v", invitation.ID, err)
+	}
+}
+
+// expireInvitations marks pending invitations whose token has expired.
+func expireInvitations(tx *gorm.DB) error {
+	return tx.Model(&models.TeamInvitation{}).
+		Where("status = ? AND expires_at <= ?", invitationPending, time.Now()).
+		Update("status", invitationExpired).Error
+}
+
+// acceptInvitation adds userID to the invitation's team with the invited role
+// and marks the invitation accepted. Users who are already members keep their
+// current role.
+func acceptInvitation(tx *gorm.DB, invitation *models.TeamInvitation, userID uint) error {
+	if invitation.Status != invitationPending || !time.Now().Before(invitation.ExpiresAt) {
+		return errInvitationInvalid
+	}
+
+	if _, err := authz.TeamRole(tx, userID, invitation.TeamID); errors.Is(err, authz.ErrNotFound) {
+		member := models.TeamMember{UserID: userID, TeamID: invitation.TeamID, Role: invitation.Role}
+		if err := tx.Create(&member).Error; err != nil {
+			return err
+		}
+		if err := publishMemberAdded(tx, &member); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	invitation.Status = invitationAccepted
+	invitation.AcceptedByID = &userID
+	invitation.AcceptedAt = &now
+	return tx.Save(invitation).Error
+}
+
+// acceptPendingInvitations accepts every pending invitation sent to the user's
+// email. It does nothing until the user has verified that they own the
+// address, so nobody can join a team by registering with someone else's email.
+func acceptPendingInvitations(user *models.User) {
+	if user.EmailVerifiedAt == nil {
+		return
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := expireInvitations(tx); err != nil {
+			return err
+		}
+
+		var invitations []models.TeamInvitation
+		if err := tx.Where("email = ? AND status = ?", normalizeEmail(user.Email), invitationPending).Find(&invitations).Error; err != nil {
+			return err
+		}
+		for i := range invitations {
+			if err := acceptInvitation(tx, &invitations[i], user.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error accepting pending invitations for user %d: %v", user.ID, err)
+	}
+}
+
+func ListTeamInvitations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	teamID, err := strconv.ParseUint(vars["teamId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	var team models.Team
+	if _, err := authz.Team(db.DB, userID, uint(teamID), authz.ActionManageMembers, &team); err != nil {
+		http.Error(w, "Team not found", http.StatusNotFound)
+		return
+	}
+
+	if err := expireInvitations(db.DB); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query := db.DB.Where("team_id = ?", team.ID)
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var invitations []models.TeamInvitation
+	if err := query.Order("created_at DESC").Find(&invitations).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(invitations)
+}
+
+// ResendTeamInvitation issues a fresh token for a pending or expired
+// invitation and sends it again. The previous token stops working.
+func ResendTeamInvitation(w http.ResponseWriter, r *http.Request) {
+	team, invitation, ok := loadTeamInvitation(w, r)
+	if !ok {
+		return
+	}
+
+	if invitation.Status != invitationPending && invitation.Status != invitationExpired {
+		http.Error(w, "Only pending invitations can be resent", http.StatusConflict)
+		return
+	}
+
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	invitation.TokenHash = hash
+	invitation.Status = invitationPending
+	invitation.ExpiresAt = time.Now().Add(invitationTTL)
+	if err := db.DB.Save(invitation).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendInvitation(r.Context(), team, invitation, token)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+func RevokeTeamInvitation(w http.ResponseWriter, r *http.Request) {
+	_, invitation, ok := loadTeamInvitation(w, r)
+	if !ok {
+		return
+	}
+
+	if invitation.Status != invitationPending {
+		http.Error(w, "Only pending invitations can be revoked", http.StatusConflict)
+		return
+	}
+
+	if err := db.DB.Model(invitation).Update("status", invitationRevoked).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AcceptTeamInvitation lets a signed in user redeem an invitation token.
+func AcceptTeamInvitation(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	var invitation models.TeamInvitation
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ?", auth.HashToken(input.Token)).First(&invitation).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errInvitationInvalid
+			}
+			return err
+		}
+		return acceptInvitation(tx, &invitation, userID)
+	})
+	if errors.Is(err, errInvitationInvalid) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Invitation accepted",
+		"teamId":  invitation.TeamID,
+	})
+}
+
+func loadTeamInvitation(w http.ResponseWriter, r *http.Request) (*models.Team, *models.TeamInvitation, bool) {
+	vars := mux.Vars(r)
+	teamID, err := strconv.ParseUint(vars["teamId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	invitationID, err := strconv.ParseUint(vars["invitationId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	var team models.Team
+	if _, err := authz.Team(db.DB, userID, uint(teamID), authz.ActionManageMembers, &team); err != nil {
+		http.Error(w, "Team not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	var invitation models.TeamInvitation
+	if err := db.DB.Where("team_id = ?", team.ID).First(&invitation, invitationID).Error; err != nil {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if invitation.Status == invitationPending && !time.Now().Before(invitation.ExpiresAt) {
+		invitation.Status = invitationExpired
+	}
+
+	return &team, &invitation, true
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nikhilsahni7/SurveyX/authz"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/mailer"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMailer keeps sent messages instead of delivering them.
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var mailedToken = regexp.MustCompile(`token=(\S+)`)
+
+// lastToken returns the token in the last message sent to email.
+func (m *recordingMailer) lastToken(t *testing.T, email string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To != email {
+			continue
+		}
+		match := mailedToken.FindStringSubmatch(m.messages[i].Body)
+		require.NotNil(t, match, "no token in message to %s", email)
+		token, err := url.QueryUnescape(match[1])
+		require.NoError(t, err)
+		return token
+	}
+	t.Fatalf("no message sent to %s", email)
+	return ""
+}
+
+func TestInvitationHandlers(t *testing.T) {
+	testDB := setupTestDB()
+	db.DB = testDB
+	defer func() {
+		sqlDB, _ := testDB.DB()
+		sqlDB.Close()
+	}()
+
+	sent := &recordingMailer{}
+	previousMailer := mailer.Default
+	mailer.Default = sent
+	defer func() { mailer.Default = previousMailer }()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/teams/{teamId}/invitations", ListTeamInvitations).Methods("GET")
+	router.HandleFunc("/teams/{teamId}/invitations/{invitationId}/resend", ResendTeamInvitation).Methods("POST")
+	router.HandleFunc("/teams/{teamId}/invitations/{invitationId}", RevokeTeamInvitation).Methods("DELETE")
+	router.HandleFunc("/invitations/accept", AcceptTeamInvitation).Methods("POST")
+
+	owner := createTestUser(t, "owner")
+	team := createTestTeam(t, owner, nil)
+
+	invite := func(t *testing.T) (*models.TeamInvitation, string) {
+		email := fmt.Sprintf("invitee-%d@example.com", time.Now().UnixNano())
+		invitation, err := inviteToTeam(context.Background(), &team, email, authz.RoleEditor, owner.ID)
+		require.NoError(t, err)
+		return invitation, sent.lastToken(t, email)
+	}
+	accept := func(token string, userID uint) int {
+		return serveAs(router, "POST", "/invitations/accept", map[string]string{"token": token}, userID).Code
+	}
+	invitationPath := func(invitation *models.TeamInvitation) string {
+		return fmt.Sprintf("/teams/%d/invitations/%d", team.ID, invitation.ID)
+	}
+
+	// Test that an invitation past its expiry is listed as expired and cannot
+	// be accepted
+	t.Run("Expiry", func(t *testing.T) {
+		invitation, token := invite(t)
+		require.NoError(t, db.DB.Model(invitation).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		rr := serveAs(router, "GET", fmt.Sprintf("/teams/%d/invitations?status=%s", team.ID, invitationExpired), nil, owner.ID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var invitations []models.TeamInvitation
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &invitations))
+		var ids []uint
+		for _, inv := range invitations {
+			ids = append(ids, inv.ID)
+		}
+		assert.Contains(t, ids, invitation.ID)
+
+		user := createTestUser(t, "late")
+		assert.Equal(t, http.StatusGone, accept(token, user.ID))
+	})
+
+	// Test that a token can only be used once
+	t.Run("SingleUse", func(t *testing.T) {
+		invitation, token := invite(t)
+		first := createTestUser(t, "first")
+		second := createTestUser(t, "second")
+
+		assert.Equal(t, http.StatusOK, accept(token, first.ID))
+		role, err := authz.TeamRole(db.DB, first.ID, team.ID)
+		require.NoError(t, err)
+		assert.Equal(t, authz.RoleEditor, role)
+
+		assert.Equal(t, http.StatusGone, accept(token, second.ID))
+		_, err = authz.TeamRole(db.DB, second.ID, team.ID)
+		assert.ErrorIs(t, err, authz.ErrNotFound)
+
+		var stored models.TeamInvitation
+		require.NoError(t, db.DB.First(&stored, invitation.ID).Error)
+		assert.Equal(t, invitationAccepted, stored.Status)
+		assert.Equal(t, first.ID, *stored.AcceptedByID)
+	})
+
+	// Test that a revoked invitation cannot be accepted or revoked again
+	t.Run("Revoke", func(t *testing.T) {
+		invitation, token := invite(t)
+
+		assert.Equal(t, http.StatusNoContent, serveAs(router, "DELETE", invitationPath(invitation), nil, owner.ID).Code)
+		assert.Equal(t, http.StatusConflict, serveAs(router, "DELETE", invitationPath(invitation), nil, owner.ID).Code)
+
+		user := createTestUser(t, "revoked")
+		assert.Equal(t, http.StatusGone, accept(token, user.ID))
+	})
+
+	// Test that resending issues a new token and the old one stops working
+	t.Run("ResendRotatesToken", func(t *testing.T) {
+		invitation, oldToken := invite(t)
+
+		assert.Equal(t, http.StatusOK, serveAs(router, "POST", invitationPath(invitation)+"/resend", nil, owner.ID).Code)
+		newToken := sent.lastToken(t, invitation.Email)
+		assert.NotEqual(t, oldToken, newToken)
+
+		user := createTestUser(t, "resent")
+		assert.Equal(t, http.StatusGone, accept(oldToken, user.ID))
+		assert.Equal(t, http.StatusOK, accept(newToken, user.ID))
+	})
+}
+
+// Test that signing up only accepts invitations for a verified address
+func TestAcceptPendingInvitations(t *testing.T) {
+	testDB := setupTestDB()
+	db.DB = testDB
+	defer func() {
+		sqlDB, _ := testDB.DB()
+		sqlDB.Close()
+	}()
+
+	owner := models.User{Email: fmt.Sprintf("owner-%d@example.com", time.Now().UnixNano()), Name: "Owner"}
+	require.NoError(t, db.DB.Create(&owner).Error)
+	team := models.Team{Name: "Invitation Team", OwnerID: owner.ID}
+	require.NoError(t, db.DB.Omit("Users", "Surveys").Create(&team).Error)
+
+	invitation, err := inviteToTeam(context.Background(), &team, fmt.Sprintf("Invitee-%d@Example.com", time.Now().UnixNano()), authz.RoleEditor, owner.ID)
+	require.NoError(t, err)
+
+	user := models.User{Email: invitation.Email, Name: "Invitee"}
+	require.NoError(t, db.DB.Create(&user).Error)
+
+	acceptPendingInvitations(&user)
+	_, err = authz.TeamRole(db.DB, user.ID, team.ID)
+	assert.ErrorIs(t, err, authz.ErrNotFound)
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	require.NoError(t, db.DB.Model(&user).Update("email_verified_at", now).Error)
+
+	acceptPendingInvitations(&user)
+	role, err := authz.TeamRole(db.DB, user.ID, team.ID)
+	require.NoError(t, err)
+	assert.Equal(t, authz.RoleEditor, role)
+
+	var accepted models.TeamInvitation
+	require.NoError(t, db.DB.First(&accepted, invitation.ID).Error)
+	assert.Equal(t, invitationAccepted, accepted.Status)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/auth"
+	"github.com/nikhilsahni7/SurveyX/mailer"
+	"github.com/nikhilsahni7/SurveyX/models"
+)
+
+// Reasons recorded in the login audit table.
+const (
+	loginSucceeded          = "succeeded"
+	loginMFARequired        = "mfa_required"
+	loginInvalidCredentials = "invalid_credentials"
+	loginInvalidMFACode     = "invalid_mfa_code"
+	loginThrottled          = "throttled"
+	loginEmailNotVerified   = "email_not_verified"
+)
+
+// onAccountLocked is called when repeated failures lock an account. The
+// default mails the owner, if the email belongs to an account.
+var onAccountLocked = notifyAccountLocked
+
+func notifyAccountLocked(ctx context.Context, email string, user *models.User, until time.Time) {
+	log.Printf("Login for %s locked until %s after repeated failures", email, until.Format(time.RFC3339))
+	if user == nil {
+		return
+	}
+	err := mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your SurveyX account has been temporarily locked",
+		Body: fmt.Sprintf("Hi %s,\n\nThere were too many failed attempts to sign in to your SurveyX account, so password logins are paused until %s.\n\nIf this was not you, consider resetting your password at %s/forgot-password.\n",
+			user.Name, until.Format(time.RFC1123), frontendURL()),
+	})
+	if err != nil {
+		log.Printf("Error sending lockout notification to user %d: %v", user.ID, err)
+	}
+}
+
+// clientIP returns the address of the client without the port.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func auditLogin(r *http.Request, email string, user *models.User, success bool, reason string) {
+	attempt := &models.LoginAttempt{
+		Email:     email,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   success,
+		Reason:    reason,
+	}
+	if user != nil {
+		attempt.UserID = &user.ID
+	}
+	if err := auth.AuditLogin(attempt); err != nil {
+		log.Printf("Error writing login audit record: %v", err)
+	}
+}
+
+// reserveLoginAttempt counts the attempt against the throttle before the
+// credentials are checked. It answers 429 and returns nil if the client has to
+// wait before trying the account again.
+func reserveLoginAttempt(w http.ResponseWriter, r *http.Request, email string) *auth.LoginReservation {
+	res, wait, err := auth.ReserveLogin(email, clientIP(r), time.Now())
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil
+	}
+	if wait > 0 {
+		auditLogin(r, email, nil, false, loginThrottled)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return nil
+	}
+	return res
+}
+
+// recordLoginFailure audits a failed attempt, notifying the owner if counting
+// it locked the account.
+func recordLoginFailure(r *http.Request, res *auth.LoginReservation, email string, user *models.User, reason string) {
+	auditLogin(r, email, user, false, reason)
+	if res.LockedUntil != nil {
+		// Sent in the background so locking a real account takes no longer
+		// than locking an unknown email.
+		go onAccountLocked(context.WithoutCancel(r.Context()), email, user, *res.LockedUntil)
+	}
+}
@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/auth"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaIssuer         = "SurveyX"
+	recoveryCodeCount = 10
+
+	// pendingMFATTL is how long a password check stays valid while the user
+	// looks up their code, and maxMFAAttempts how many codes they may try.
+	pendingMFATTL  = 5 * time.Minute
+	maxMFAAttempts = 5
+)
+
+// mfaInput carries a second factor: a TOTP code or a recovery code.
+type mfaInput struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// mfaRequiredForExport reports whether REQUIRE_MFA_FOR_EXPORT limits exports
+// of respondent data to users with two-factor authentication.
+func mfaRequiredForExport() bool {
+	required, _ := strconv.ParseBool(os.Getenv("REQUIRE_MFA_FOR_EXPORT"))
+	return required
+}
+
+// LoginMFAHandler completes a password login for a user with two-factor
+// authentication.
+func LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var input mfaInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, err := auth.Store.Get(r, "session-name")
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+	userID, ok := session.Values["pending_mfa"].(uint)
+	startedAt, _ := session.Values["pending_mfa_at"].(int64)
+	if !ok || time.Since(time.Unix(startedAt, 0)) > pendingMFATTL {
+		http.Error(w, "No login is waiting for a two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "No login is waiting for a two-factor code", http.StatusUnauthorized)
+		return
+	}
+	attempt := reserveLoginAttempt(w, r, user.Email)
+	if attempt == nil {
+		return
+	}
+
+	valid, err := verifySecondFactor(db.DB, &user, input)
+	if err != nil {
+		if err := attempt.Release(); err != nil {
+			log.Printf("Error releasing login attempt: %v", err)
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		recordLoginFailure(r, attempt, user.Email, &user, loginInvalidMFACode)
+
+		attempts, _ := session.Values["mfa_attempts"].(int)
+		attempts++
+		if attempts >= maxMFAAttempts {
+			// Too many wrong codes; the password has to be entered again.
+			session.Values = make(map[interface{}]interface{})
+		} else {
+			session.Values["mfa_attempts"] = attempts
+		}
+		if err := session.Save(r, w); err != nil {
+			log.Printf("Error saving session: %v", err)
+		}
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := auth.StartSession(w, r, session, user.ID, clientIP(r)); err != nil {
+		http.Error(w, "Failed to save session", http.StatusInternalServerError)
+		return
+	}
+
+	if err := attempt.Succeed(); err != nil {
+		log.Printf("Error clearing failed logins: %v", err)
+	}
+	auditLogin(r, user.Email, &user, true, loginSucceeded)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Login successful"})
+}
+
+// SetupMFA starts enrollment by generating a secret for the user's
+// authenticator app. It only takes effect once EnableMFA confirms a code.
+func SetupMFA(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uint)
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.MFAEnabledAt != nil {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.DB.Model(&user).Update("mfa_pending_secret", secret).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":          secret,
+		"provisioningUri": auth.TOTPProvisioningURI(secret, user.Email, mfaIssuer),
+	})
+}
+
+// EnableMFA confirms enrollment with a code from the authenticator app and
+// returns the recovery codes, which are not shown again.
+func EnableMFA(w http.ResponseWriter, r *http.Request) {
+	var input mfaInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.MFAEnabledAt != nil {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if user.MFAPendingSecret == "" {
+		http.Error(w, "Start two-factor setup first", http.StatusBadRequest)
+		return
+	}
+
+	step, ok := auth.VerifyTOTP(user.MFAPendingSecret, input.Code, time.Now(), 0)
+	if !ok {
+		http.Error(w, "Invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	var codes []string
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"mfa_secret":         user.MFAPendingSecret,
+			"mfa_pending_secret": "",
+			"mfa_last_step":      step,
+			"mfa_enabled_at":     now,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": codes,
+	})
+}
+
+// DisableMFA turns two-factor authentication off after checking a current
+// code or recovery code.
+func DisableMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := checkSecondFactor(w, r)
+	if !ok {
+		return
+	}
+
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		return clearMFA(tx, user.ID)
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a
+// current code.
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := checkSecondFactor(w, r)
+	if !ok {
+		return
+	}
+
+	var codes []string
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"recoveryCodes": codes})
+}
+
+// AdminResetMFA turns off two-factor authentication for a user who lost both
+// their authenticator and their recovery codes.
+func AdminResetMFA(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	targetID := parseUintParam(r, "userId")
+	var target models.User
+	if err := db.DB.First(&target, targetID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// The reset is for users who lost their second factor; sessions started
+	// before it are signed out in case the account was taken over.
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := clearMFA(tx, target.ID); err != nil {
+			return err
+		}
+		return auth.RevokeSessions(tx, target.ID, 0)
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	adminID := r.Context().Value("userID").(uint)
+	log.Printf("Admin %d reset two-factor authentication for user %d", adminID, target.ID)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication reset"})
+}
+
+// checkSecondFactor loads the current user and checks the code in the request
+// body against their enabled second factor.
+func checkSecondFactor(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	var input mfaInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	if user.MFAEnabledAt == nil {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return nil, false
+	}
+
+	valid, err := verifySecondFactor(db.DB, &user, input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if !valid {
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return nil, false
+	}
+	return &user, true
+}
+
+// verifySecondFactor accepts a TOTP code newer than the last one used, or an
+// unused recovery code, and records its use so it cannot be replayed.
+func verifySecondFactor(tx *gorm.DB, user *models.User, input mfaInput) (bool, error) {
+	if user.MFAEnabledAt == nil {
+		return false, nil
+	}
+
+	if input.RecoveryCode != "" {
+		result := tx.Model(&models.MFARecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, auth.HashRecoveryCode(input.RecoveryCode)).
+			Update("used_at", time.Now())
+		return result.RowsAffected > 0, result.Error
+	}
+
+	step, ok := auth.VerifyTOTP(user.MFASecret, input.Code, time.Now(), user.MFALastStep)
+	if !ok {
+		return false, nil
+	}
+	// The condition on mfa_last_step stops two concurrent requests from
+	// using the same code.
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND mfa_last_step < ?", user.ID, step).
+		Update("mfa_last_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes, hashes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	for _, hash := range hashes {
+		if err := tx.Create(&models.MFARecoveryCode{UserID: userID, CodeHash: hash}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func clearMFA(tx *gorm.DB, userID uint) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"mfa_secret":         "",
+		"mfa_pending_secret": "",
+		"mfa_last_step":      0,
+		"mfa_enabled_at":     nil,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error
+}
+
+// requireAdmin answers 403 unless the current user is an administrator.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	userID := r.Context().Value("userID").(uint)
+	var user models.User
+	err := db.DB.Select("id", "is_admin").First(&user, userID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if err != nil || !user.IsAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/auth"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/models"
+)
+
+type sessionView struct {
+	ID         uint      `json:"id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+// ListSessions returns the user's active sessions, most recently used first.
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uint)
+	currentID, _ := r.Context().Value("sessionID").(uint)
+
+	var records []models.UserSession
+	if err := db.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&records).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]sessionView, 0, len(records))
+	for _, s := range records {
+		views = append(views, sessionView{
+			ID:         s.ID,
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == currentID,
+		})
+	}
+	json.NewEncoder(w).Encode(views)
+}
+
+// RevokeSession signs one of the user's sessions out.
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	id := parseUintParam(r, "id")
+	userID := r.Context().Value("userID").(uint)
+
+	result := db.DB.Model(&models.UserSession{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeOtherSessions signs the user out everywhere except this session.
+func RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uint)
+	currentID, _ := r.Context().Value("sessionID").(uint)
+	if currentID == 0 {
+		http.Error(w, "Only available to browser sessions", http.StatusBadRequest)
+		return
+	}
+
+	if err := auth.RevokeSessions(db.DB, userID, currentID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/antonlindstrom/pgstore"
+	"github.com/gorilla/mux"
+	"github.com/nikhilsahni7/SurveyX/auth"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionHandlers(t *testing.T) {
+	testDB := setupTestDB()
+	db.DB = testDB
+	defer func() {
+		sqlDB, _ := testDB.DB()
+		sqlDB.Close()
+	}()
+
+	store, err := pgstore.NewPGStore(testDatabaseURL, []byte("test-session-key"))
+	require.NoError(t, err)
+	defer store.Close()
+	previousStore := auth.Store
+	auth.Store = store
+	defer func() { auth.Store = previousStore }()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/surveys", auth.RequireScope(auth.ScopeSurveysRead, ListSurveys)).Methods("GET")
+	router.HandleFunc("/password/reset", ResetPassword).Methods("POST")
+	router.HandleFunc("/user/password", auth.AuthMiddleware(ChangePassword)).Methods("POST")
+	router.HandleFunc("/user/sessions", auth.AuthMiddleware(ListSessions)).Methods("GET")
+	router.HandleFunc("/user/sessions", auth.AuthMiddleware(RevokeOtherSessions)).Methods("DELETE")
+	router.HandleFunc("/user/sessions/{id}", auth.AuthMiddleware(RevokeSession)).Methods("DELETE")
+
+	// signIn starts a recorded session for user and returns its cookie.
+	signIn := func(t *testing.T, user models.User) *http.Cookie {
+		req := httptest.NewRequest("POST", "/login", nil)
+		rr := httptest.NewRecorder()
+		session, err := auth.Store.New(req, "session-name")
+		require.NoError(t, err)
+		require.NoError(t, auth.StartSession(rr, req, session, user.ID, "192.0.2.1"))
+		cookies := rr.Result().Cookies()
+		require.NotEmpty(t, cookies)
+		return cookies[0]
+	}
+	serve := func(method, path string, body interface{}, cookie *http.Cookie) *httptest.ResponseRecorder {
+		encoded, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(encoded))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	send := func(method, path string, body interface{}, cookie *http.Cookie) int {
+		return serve(method, path, body, cookie).Code
+	}
+	currentSession := func(t *testing.T, cookie *http.Cookie) sessionView {
+		rr := serve("GET", "/user/sessions", nil, cookie)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var views []sessionView
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &views))
+		for _, v := range views {
+			if v.Current {
+				return v
+			}
+		}
+		t.Fatal("no current session listed")
+		return sessionView{}
+	}
+
+	// Test that a revoked session record is refused even though its cookie is
+	// still valid
+	t.Run("RevokedSessionIsRefused", func(t *testing.T) {
+		user := createTestUser(t, "revoked-session")
+		cookie := signIn(t, user)
+		assert.Equal(t, http.StatusOK, send("GET", "/surveys", nil, cookie))
+
+		var record models.UserSession
+		require.NoError(t, db.DB.Where("user_id = ?", user.ID).First(&record).Error)
+		assert.Equal(t, "192.0.2.1", record.IP)
+		require.NoError(t, auth.RevokeSessions(db.DB, user.ID, 0))
+
+		assert.Equal(t, http.StatusUnauthorized, send("GET", "/surveys", nil, cookie))
+	})
+
+	// Test that users can only revoke their own sessions
+	t.Run("RevokeSession", func(t *testing.T) {
+		user := createTestUser(t, "session-owner")
+		other := createTestUser(t, "session-other")
+		userCookie, otherCookie := signIn(t, user), signIn(t, other)
+		userSession := currentSession(t, userCookie)
+
+		assert.Equal(t, http.StatusNotFound, send("DELETE", fmt.Sprintf("/user/sessions/%d", userSession.ID), nil, otherCookie))
+		assert.Equal(t, http.StatusOK, send("GET", "/user/sessions", nil, userCookie))
+
+		assert.Equal(t, http.StatusNoContent, send("DELETE", fmt.Sprintf("/user/sessions/%d", userSession.ID), nil, userCookie))
+		assert.Equal(t, http.StatusUnauthorized, send("GET", "/user/sessions", nil, userCookie))
+		assert.Equal(t, http.StatusOK, send("GET", "/user/sessions", nil, otherCookie))
+	})
+
+	// Test that RevokeOtherSessions keeps only the current session
+	t.Run("RevokeOtherSessions", func(t *testing.T) {
+		user := createTestUser(t, "other-sessions")
+		current, laptop, phone := signIn(t, user), signIn(t, user), signIn(t, user)
+
+		assert.Equal(t, http.StatusNoContent, send("DELETE", "/user/sessions", nil, current))
+		assert.Equal(t, http.StatusOK, send("GET", "/user/sessions", nil, current))
+		assert.Equal(t, http.StatusUnauthorized, send("GET", "/user/sessions", nil, laptop))
+		assert.Equal(t, http.StatusUnauthorized, send("GET", "/user/sessions", nil, phone))
+	})
+
+	// Test that changing the password signs out the other sessions and
+	// resetting it signs out all of them
+	t.Run("PasswordChangeRevokesSessions", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("bcrypt at production cost is slow")
+		}
+		user := createTestUser(t, "password-sessions")
+		current, other := signIn(t, user), signIn(t, user)
+
+		assert.Equal(t, http.StatusOK, send("POST", "/user/password", map[string]string{"newPassword": "a new password"}, current))
+		assert.Equal(t, http.StatusOK, send("GET", "/user/sessions", nil, current))
+		assert.Equal(t, http.StatusUnauthorized, send("GET", "/user/sessions", nil, other))
+
+		token, err := auth.IssueUserToken(db.DB, user.ID, auth.PurposePasswordReset, time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, send("POST", "/password/reset", map[string]string{"token": token, "password": "another password"}, nil))
+		assert.Equal(t, http.StatusUnauthorized, send("GET", "/user/sessions", nil, current))
+	})
+}
@@ -2,15 +2,22 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/nikhilsahni7/SurveyX/authz"
 	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/logic"
 	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/nikhilsahni7/SurveyX/validation"
+	"github.com/nikhilsahni7/SurveyX/webhooks"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func CreateSurvey(w http.ResponseWriter, r *http.Request) {
@@ -23,30 +30,27 @@ func CreateSurvey(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(uint)
 	survey.UserID = userID
 	survey.Version = 1
+
+	// Creating a survey under a team needs edit rights in that team.
+	if survey.TeamID != nil {
+		role, err := authz.TeamRole(db.DB, userID, *survey.TeamID)
+		if err != nil || !authz.Can(role, authz.ActionEditSurvey) {
+			http.Error(w, "Team not found", http.StatusNotFound)
+			return
+		}
+	}
 	survey.ReleaseDate = withDefaultTime(survey.ReleaseDate, time.Now())
 	survey.CloseDate = withDefaultTime(survey.CloseDate, time.Now().AddDate(0, 1, 0))
 
 	if err := db.DB.Transaction(func(tx *gorm.DB) error {
 		// Create the survey
-		if err := tx.Create(&survey).Error; err != nil {
+		if err := tx.Omit("Sections", "Questions", "Responses").Create(&survey).Error; err != nil {
 			return err
 		}
 
-		// Create questions and options
-		for i := range survey.Questions {
-			survey.Questions[i].ID = 0 // Ensure new record is created
-			survey.Questions[i].SurveyID = survey.ID
-			if err := tx.Create(&survey.Questions[i]).Error; err != nil {
-				return err
-			}
-
-			for j := range survey.Questions[i].Options {
-				survey.Questions[i].Options[j].ID = 0 // Ensure new record is created
-				survey.Questions[i].Options[j].QuestionID = survey.Questions[i].ID
-				if err := tx.Create(&survey.Questions[i].Options[j]).Error; err != nil {
-					return err
-				}
-			}
+		// Create sections, questions, options, conditions and page rules
+		if err := createSurveyContent(tx, survey.ID, survey.Sections, survey.Questions); err != nil {
+			return err
 		}
 
 		// Create survey link
@@ -59,15 +63,15 @@ func CreateSurvey(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
-		return nil
+		return publishSurveyEvent(tx, survey.ID, webhooks.EventSurveyCreated)
 	}); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeSurveyError(w, err)
 		return
 	}
 
 	// Fetch the created survey with all its relations
 	var createdSurvey models.Survey
-	if err := db.DB.Preload("Questions.Options").First(&createdSurvey, survey.ID).Error; err != nil {
+	if err := db.DB.Preload("Sections.Rules").Preload("Questions.Options").Preload("Questions.Rows").Preload("Questions.Conditions").First(&createdSurvey, survey.ID).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -84,42 +88,59 @@ func UpdateSurvey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID := r.Context().Value("userID").(uint)
 	var existingSurvey models.Survey
-	if err := db.DB.First(&existingSurvey, id).Error; err != nil {
+	if err := authz.Survey(db.DB, userID, id, authz.ActionEditSurvey, &existingSurvey); err != nil {
 		http.Error(w, "Survey not found", http.StatusNotFound)
 		return
 	}
 
 	existingSurvey.Title = updatedSurvey.Title
 	existingSurvey.Description = updatedSurvey.Description
-	existingSurvey.Version++
 
-	if err := db.DB.Save(&existingSurvey).Error; err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// A revision that has been live is frozen, so edits start a new
+		// version. Drafts that were never published are edited in place.
+		if existingSurvey.IsPublished {
+			if err := snapshotSurvey(tx, &existingSurvey); err != nil {
+				return err
+			}
+		}
+		frozen, err := versionExists(tx, existingSurvey.ID, existingSurvey.Version)
+		if err != nil {
+			return err
+		}
+		if frozen {
+			existingSurvey.Version++
+		}
 
-	if err := db.DB.Where("survey_id = ?", id).Delete(&models.Question{}).Error; err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+		if err := tx.Save(&existingSurvey).Error; err != nil {
+			return err
+		}
 
-	for i := range updatedSurvey.Questions {
-		updatedSurvey.Questions[i].ID = 0
-		updatedSurvey.Questions[i].SurveyID = existingSurvey.ID
-		if err := db.DB.Create(&updatedSurvey.Questions[i]).Error; err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		if err := tx.Where("section_id IN (?)", tx.Model(&models.Section{}).Select("id").Where("survey_id = ?", id)).Delete(&models.PageRule{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("survey_id = ?", id).Delete(&models.Section{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("survey_id = ?", id).Delete(&models.Question{}).Error; err != nil {
+			return err
+		}
+
+		if err := createSurveyContent(tx, existingSurvey.ID, updatedSurvey.Sections, updatedSurvey.Questions); err != nil {
+			return err
 		}
 
-		for j := range updatedSurvey.Questions[i].Options {
-			updatedSurvey.Questions[i].Options[j].ID = 0
-			updatedSurvey.Questions[i].Options[j].QuestionID = updatedSurvey.Questions[i].ID
-			if err := db.DB.Create(&updatedSurvey.Questions[i].Options[j]).Error; err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
+		if existingSurvey.IsPublished {
+			if err := snapshotSurvey(tx, &existingSurvey); err != nil {
+				return err
 			}
 		}
+		return publishSurveyEvent(tx, existingSurvey.ID, webhooks.EventSurveyUpdated)
+	}); err != nil {
+		writeSurveyError(w, err)
+		return
 	}
 
 	json.NewEncoder(w).Encode(existingSurvey)
@@ -129,7 +150,26 @@ func ListSurveys(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(uint)
 	var surveys []models.Survey
 
-	if err := db.DB.Where("user_id = ?", userID).Find(&surveys).Error; err != nil {
+	// scope is "mine" for personal surveys, "team:<id>" for the surveys of one
+	// team, or "all" (the default) for personal and team surveys together.
+	query := db.DB.Scopes(authz.Surveys(userID, authz.ActionViewSurvey))
+	switch scope := r.URL.Query().Get("scope"); {
+	case scope == "" || scope == "all":
+	case scope == "mine":
+		query = query.Where("surveys.team_id IS NULL")
+	case strings.HasPrefix(scope, "team:"):
+		teamID, err := strconv.ParseUint(strings.TrimPrefix(scope, "team:"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid team ID", http.StatusBadRequest)
+			return
+		}
+		query = query.Where("surveys.team_id = ?", teamID)
+	default:
+		http.Error(w, "scope must be mine, team:<id> or all", http.StatusBadRequest)
+		return
+	}
+
+	if err := query.Order("surveys.created_at DESC").Find(&surveys).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -137,11 +177,53 @@ func ListSurveys(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(surveys)
 }
 
+// MoveSurvey moves a survey into a team, or back to a personal survey of the
+// current user when teamId is null. The user needs delete rights on the survey
+// where it is now and edit rights in the destination team.
+func MoveSurvey(w http.ResponseWriter, r *http.Request) {
+	id := parseUintParam(r, "id")
+	userID := r.Context().Value("userID").(uint)
+
+	var input struct {
+		TeamID *uint `json:"teamId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var survey models.Survey
+	if err := authz.Survey(db.DB, userID, id, authz.ActionDeleteSurvey, &survey); err != nil {
+		http.Error(w, "Survey not found", http.StatusNotFound)
+		return
+	}
+
+	if input.TeamID != nil {
+		role, err := authz.TeamRole(db.DB, userID, *input.TeamID)
+		if err != nil || !authz.Can(role, authz.ActionEditSurvey) {
+			http.Error(w, "Team not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	survey.TeamID = input.TeamID
+	if input.TeamID == nil {
+		survey.UserID = userID
+	}
+	if err := db.DB.Model(&survey).Select("team_id", "user_id").Updates(&survey).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(survey)
+}
+
 func GetSurvey(w http.ResponseWriter, r *http.Request) {
 	id := parseUintParam(r, "id")
+	userID := r.Context().Value("userID").(uint)
 
 	var survey models.Survey
-	if err := db.DB.Preload("Questions.Options").First(&survey, id).Error; err != nil {
+	if err := authz.Survey(db.DB.Preload("Sections.Rules").Preload("Questions.Options").Preload("Questions.Rows").Preload("Questions.Conditions"), userID, id, authz.ActionViewSurvey, &survey); err != nil {
 		http.Error(w, "Survey not found", http.StatusNotFound)
 		return
 	}
@@ -151,6 +233,12 @@ func GetSurvey(w http.ResponseWriter, r *http.Request) {
 
 func DeleteSurvey(w http.ResponseWriter, r *http.Request) {
 	id := parseUintParam(r, "id")
+	userID := r.Context().Value("userID").(uint)
+
+	if err := authz.CheckSurvey(db.DB, userID, id, authz.ActionDeleteSurvey); err != nil {
+		http.Error(w, "Survey not found", http.StatusNotFound)
+		return
+	}
 
 	if err := db.DB.Delete(&models.Survey{}, id).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -170,8 +258,31 @@ func UnpublishSurvey(w http.ResponseWriter, r *http.Request) {
 
 func updateSurveyStatus(w http.ResponseWriter, r *http.Request, isPublished bool) {
 	id := parseUintParam(r, "id")
+	userID := r.Context().Value("userID").(uint)
+
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var survey models.Survey
+		if err := authz.Survey(tx, userID, id, authz.ActionPublishSurvey, &survey); err != nil {
+			return err
+		}
+		if err := tx.Model(&survey).Update("is_published", isPublished).Error; err != nil {
+			return err
+		}
 
-	if err := db.DB.Model(&models.Survey{}).Where("id = ?", id).Update("is_published", isPublished).Error; err != nil {
+		// Publishing freezes the current revision.
+		event := webhooks.EventSurveyUnpublished
+		if isPublished {
+			if err := snapshotSurvey(tx, &survey); err != nil {
+				return err
+			}
+			event = webhooks.EventSurveyPublished
+		}
+		return publishSurveyEvent(tx, survey.ID, event)
+	}); err != nil {
+		if errors.Is(err, authz.ErrNotFound) {
+			http.Error(w, "Survey not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -187,6 +298,9 @@ func SubmitResponse(w http.ResponseWriter, r *http.Request) {
 			QuestionID uint   `json:"questionId"`
 			Value      string `json:"value"`
 		} `json:"answers"`
+		// Seed is the shuffle seed the survey was shown with, if the
+		// client does not use the seed cookie.
+		Seed string `json:"seed"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&responseData); err != nil {
@@ -194,27 +308,88 @@ func SubmitResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := models.Response{
-		SurveyID:  surveyID,
-		IP:        r.RemoteAddr,
-		UserAgent: r.UserAgent(),
+	var survey models.Survey
+	if err := db.DB.Preload("Sections.Rules").Preload("Questions.Options").Preload("Questions.Rows").Preload("Questions.Conditions").First(&survey, surveyID).Error; err != nil {
+		http.Error(w, "Survey not found", http.StatusNotFound)
+		return
 	}
 
-	if err := db.DB.Create(&response).Error; err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := checkAvailability(db.DB, &survey, time.Now()); err != nil {
+		writeAvailabilityError(w, err)
 		return
 	}
 
+	answers := make([]models.Answer, 0, len(responseData.Answers))
 	for _, answerData := range responseData.Answers {
-		answer := models.Answer{
-			ResponseID: response.ID,
+		answers = append(answers, models.Answer{
 			QuestionID: answerData.QuestionID,
 			Value:      answerData.Value,
-		}
-		if err := db.DB.Create(&answer).Error; err != nil {
+		})
+	}
+
+	if err := validation.ValidateSurveyResponse(survey.Sections, survey.Questions, answers); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	now := time.Now()
+	response := models.Response{
+		SurveyID:    surveyID,
+		IP:          r.RemoteAddr,
+		UserAgent:   r.UserAgent(),
+		Status:      responseCompleted,
+		CompletedAt: &now,
+	}
+
+	// Record the order the respondent was shown, as AccessSurveyByLink
+	// computed it from the same seed.
+	if seed := submittedSeed(r, responseData.Seed); seed != "" {
+		order, err := encodeOrder(logic.Shuffle(logic.Pages(survey.Sections, survey.Questions), seed))
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		response.DisplayOrder = order
+	}
+
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the survey row so concurrent submissions are counted one at a
+		// time against the response limit.
+		var locked models.Survey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, surveyID).Error; err != nil {
+			return err
+		}
+		if err := checkAvailability(tx, &locked, time.Now()); err != nil {
+			return err
+		}
+
+		// Pin the response to the revision it answered. Publishing and
+		// editing a published survey already snapshot that revision.
+		if locked.Version != survey.Version {
+			return errSurveyChanged
+		}
+		response.Version = locked.Version
+
+		if err := tx.Create(&response).Error; err != nil {
+			return err
+		}
+
+		for i := range answers {
+			answers[i].ResponseID = response.ID
+			if err := tx.Create(&answers[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		response.Answers = answers
+		return responseCompletedEvents(tx, &locked, &response)
+	}); err != nil {
+		if errors.Is(err, errSurveyChanged) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeAvailabilityError(w, err)
+		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
@@ -223,9 +398,15 @@ func SubmitResponse(w http.ResponseWriter, r *http.Request) {
 
 func ListResponses(w http.ResponseWriter, r *http.Request) {
 	surveyID := parseUintParam(r, "id")
+	userID := r.Context().Value("userID").(uint)
+
+	if err := authz.CheckSurvey(db.DB, userID, surveyID, authz.ActionViewResponses); err != nil {
+		http.Error(w, "Survey not found", http.StatusNotFound)
+		return
+	}
 
 	var responses []models.Response
-	if err := db.DB.Where("survey_id = ?", surveyID).Preload("Answers").Find(&responses).Error; err != nil {
+	if err := db.DB.Where("survey_id = ? AND status = ?", surveyID, responseCompleted).Preload("Answers").Find(&responses).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -236,50 +417,49 @@ func ListResponses(w http.ResponseWriter, r *http.Request) {
 func DuplicateSurvey(w http.ResponseWriter, r *http.Request) {
 	id := parseUintParam(r, "id")
 
+	userID := r.Context().Value("userID").(uint)
 	var originalSurvey models.Survey
-	if err := db.DB.Preload("Questions.Options").First(&originalSurvey, id).Error; err != nil {
+	if err := authz.Survey(db.DB.Preload("Sections.Rules").Preload("Questions.Options").Preload("Questions.Rows").Preload("Questions.Conditions"), userID, id, authz.ActionViewSurvey, &originalSurvey); err != nil {
 		http.Error(w, "Survey not found", http.StatusNotFound)
 		return
 	}
 
 	newSurvey := originalSurvey
 	newSurvey.ID = 0
+	newSurvey.UserID = userID
 	newSurvey.Title = "Copy of " + newSurvey.Title
 	newSurvey.Version = 1
 	newSurvey.IsPublished = false
+	newSurvey.ClosedEventAt = nil
 	newSurvey.CreatedAt = time.Now()
 	newSurvey.UpdatedAt = time.Now()
 
-	if err := db.DB.Create(&newSurvey).Error; err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	// Viewing a team survey is not enough to add one to the team, so the copy
+	// is personal unless the caller can edit surveys there.
+	if newSurvey.TeamID != nil {
+		role, err := authz.TeamRole(db.DB, userID, *newSurvey.TeamID)
+		if err != nil || !authz.Can(role, authz.ActionEditSurvey) {
+			newSurvey.TeamID = nil
+		}
 	}
 
-	for i := range newSurvey.Questions {
-		newSurvey.Questions[i].ID = 0
-		newSurvey.Questions[i].SurveyID = newSurvey.ID
-		if err := db.DB.Create(&newSurvey.Questions[i]).Error; err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Sections", "Questions").Create(&newSurvey).Error; err != nil {
+			return err
 		}
 
-		for j := range newSurvey.Questions[i].Options {
-			newSurvey.Questions[i].Options[j].ID = 0
-			newSurvey.Questions[i].Options[j].QuestionID = newSurvey.Questions[i].ID
-			if err := db.DB.Create(&newSurvey.Questions[i].Options[j]).Error; err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+		if err := createSurveyContent(tx, newSurvey.ID, newSurvey.Sections, newSurvey.Questions); err != nil {
+			return err
 		}
-	}
 
-	link := models.SurveyLink{
-		SurveyID: newSurvey.ID,
-		Link:     generateSurveyLink(newSurvey.ID),
-		IsActive: true,
-	}
-	if err := db.DB.Create(&link).Error; err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		link := models.SurveyLink{
+			SurveyID: newSurvey.ID,
+			Link:     generateSurveyLink(newSurvey.ID),
+			IsActive: true,
+		}
+		return tx.Create(&link).Error
+	}); err != nil {
+		writeSurveyError(w, err)
 		return
 	}
 
@@ -297,24 +477,74 @@ func AccessSurveyByLink(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var survey models.Survey
-	if err := db.DB.Preload("Questions.Options").First(&survey, surveyLink.SurveyID).Error; err != nil {
+	if err := db.DB.Preload("Sections.Rules").Preload("Questions.Options").Preload("Questions.Rows").Preload("Questions.Conditions").First(&survey, surveyLink.SurveyID).Error; err != nil {
 		http.Error(w, "Survey not found", http.StatusNotFound)
 		return
 	}
 
+	if err := checkAvailability(db.DB, &survey, time.Now()); err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
 	// Remove sensitive information
 	survey.UserID = 0
 	survey.Responses = nil
 
-	json.NewEncoder(w).Encode(survey)
+	seed, err := respondentSeed(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Shuffle on the server so every client shows the same order, and the
+	// order can be recorded with the response.
+	pages := logic.Pages(survey.Sections, survey.Questions)
+	pages = logic.ApplyOrder(pages, logic.Shuffle(pages, seed))
+	logicRules := logic.Rules(survey.Questions)
+	survey.Sections = nil
+	// Clients that predate pages read the flat list, so keep it in the order
+	// the pages show.
+	survey.Questions = make([]models.Question, 0, len(survey.Questions))
+	for _, page := range pages {
+		survey.Questions = append(survey.Questions, page.Questions...)
+	}
+
+	json.NewEncoder(w).Encode(publicSurvey{
+		Survey: survey,
+		Pages:  pages,
+		Logic:  logicRules,
+		Seed:   seed,
+	})
+}
+
+// publicSurvey is the payload served to respondents. Questions are grouped by
+// page in Pages, each with the jumps to take after it, in the respondent's
+// shuffled order, and also listed in that order in Questions. Logic carries
+// the conditional display rules in a stable form so the frontend can show and
+// hide questions while the respondent fills in the survey. Seed is sent back
+// on submission by clients without cookies.
+type publicSurvey struct {
+	models.Survey
+	Pages []logic.Page `json:"pages"`
+	Logic []logic.Rule `json:"logic"`
+	Seed  string       `json:"seed"`
 }
 
 func GetResponse(w http.ResponseWriter, r *http.Request) {
 	surveyID := parseUintParam(r, "id")
 	responseID := parseUintParam(r, "responseId")
+	userID := r.Context().Value("userID").(uint)
+
+	// Load the questions to provide more context; this also checks access
+	var survey models.Survey
+	if err := authz.Survey(db.DB.Preload("Questions"), userID, surveyID, authz.ActionViewResponses, &survey); err != nil {
+		http.Error(w, "Survey not found", http.StatusNotFound)
+		return
+	}
 
 	var response models.Response
-	if err := db.DB.Where("survey_id = ? AND id = ?", surveyID, responseID).Preload("Answers").First(&response).Error; err != nil {
+	if err := db.DB.Where("survey_id = ? AND id = ? AND status = ?", surveyID, responseID, responseCompleted).Preload("Answers").First(&response).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			http.Error(w, "Response not found", http.StatusNotFound)
 		} else {
@@ -323,12 +553,13 @@ func GetResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Optionally, you can load the questions to provide more context
-	var survey models.Survey
-	if err := db.DB.Preload("Questions").First(&survey, surveyID).Error; err != nil {
-		http.Error(w, "Survey not found", http.StatusNotFound)
+	survey.Responses = []models.Response{response}
+	questions, _, err := answeredQuestions(db.DB, &survey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	survey.Questions = questions
 
 	// Create a more informative response structure
 	type AnswerWithQuestion struct {
@@ -338,21 +569,28 @@ func GetResponse(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type ResponseWithQuestions struct {
-		ID        uint                 `json:"id"`
-		SurveyID  uint                 `json:"surveyId"`
-		CreatedAt time.Time            `json:"createdAt"`
-		IP        string               `json:"ip"`
-		UserAgent string               `json:"userAgent"`
-		Answers   []AnswerWithQuestion `json:"answers"`
+		ID        uint      `json:"id"`
+		SurveyID  uint      `json:"surveyId"`
+		Version   int       `json:"version"`
+		Status    string    `json:"status"`
+		CreatedAt time.Time `json:"createdAt"`
+		IP        string    `json:"ip"`
+		UserAgent string    `json:"userAgent"`
+		// DisplayOrder is the order questions and options were shown in.
+		DisplayOrder logic.Order          `json:"displayOrder"`
+		Answers      []AnswerWithQuestion `json:"answers"`
 	}
 
 	responseWithQuestions := ResponseWithQuestions{
-		ID:        response.ID,
-		SurveyID:  response.SurveyID,
-		CreatedAt: response.CreatedAt,
-		IP:        response.IP,
-		UserAgent: response.UserAgent,
-		Answers:   make([]AnswerWithQuestion, 0),
+		ID:           response.ID,
+		SurveyID:     response.SurveyID,
+		Version:      response.Version,
+		Status:       response.Status,
+		CreatedAt:    response.CreatedAt,
+		IP:           response.IP,
+		UserAgent:    response.UserAgent,
+		DisplayOrder: decodeOrder(response.DisplayOrder),
+		Answers:      make([]AnswerWithQuestion, 0),
 	}
 
 	questionMap := make(map[uint]string)
@@ -372,8 +610,235 @@ func GetResponse(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(responseWithQuestions)
 }
 
+func DeleteResponse(w http.ResponseWriter, r *http.Request) {
+	surveyID := parseUintParam(r, "id")
+	responseID := parseUintParam(r, "responseId")
+	userID := r.Context().Value("userID").(uint)
+
+	if err := authz.CheckSurvey(db.DB, userID, surveyID, authz.ActionDeleteResponses); err != nil {
+		http.Error(w, "Survey not found", http.StatusNotFound)
+		return
+	}
+
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var response models.Response
+		if err := tx.Where("survey_id = ? AND id = ?", surveyID, responseID).Preload("Answers").First(&response).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&response).Error; err != nil {
+			return err
+		}
+		if response.Status != responseCompleted {
+			return nil
+		}
+		return publishResponseEvent(tx, &response, webhooks.EventResponseDeleted)
+	}); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Response not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // Helper functions
 
+// errSurveyChanged is returned when a survey is edited between validating a
+// submission and storing it.
+var errSurveyChanged = errors.New("survey was updated while submitting, please reload it")
+
+// surveyDefinitionError reports a mistake in a survey definition sent by the
+// client, as opposed to a database failure.
+type surveyDefinitionError struct {
+	msg string
+}
+
+func (e surveyDefinitionError) Error() string {
+	return e.msg
+}
+
+// writeValidationError responds with 422 and the list of failing fields, or
+// with 500 for any other error.
+func writeValidationError(w http.ResponseWriter, err error) {
+	var validationErr *validation.Error
+	if !errors.As(err, &validationErr) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "Validation failed",
+		"fields": validationErr.Fields,
+	})
+}
+
+func writeSurveyError(w http.ResponseWriter, err error) {
+	var defErr surveyDefinitionError
+	if errors.As(err, &defErr) {
+		http.Error(w, defErr.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// createSurveyContent inserts the sections, questions and page rules of a
+// survey. Questions reference their section, and page rules questions and
+// sections, by the IDs the client sent; like condition references in
+// createQuestions, they are rewritten to the IDs of the new rows. Surveys with
+// sections must put every question in one, and page rules may only look at
+// questions up to their own page and only jump forward.
+func createSurveyContent(tx *gorm.DB, surveyID uint, sections []models.Section, questions []models.Question) error {
+	sectionIDs := make(map[uint]uint, len(sections))
+	for i := range sections {
+		section := &sections[i]
+		clientID := section.ID
+
+		section.ID = 0
+		section.SurveyID = surveyID
+		if err := tx.Omit("Rules").Create(section).Error; err != nil {
+			return err
+		}
+		if clientID != 0 {
+			sectionIDs[clientID] = section.ID
+		}
+	}
+
+	for i := range questions {
+		question := &questions[i]
+		if len(sections) == 0 {
+			question.SectionID = nil
+			continue
+		}
+		if question.SectionID == nil {
+			return surveyDefinitionError{fmt.Sprintf("question %q belongs to no section", question.Text)}
+		}
+		sectionID, ok := sectionIDs[*question.SectionID]
+		if !ok {
+			return surveyDefinitionError{fmt.Sprintf("question %q references an unknown section", question.Text)}
+		}
+		question.SectionID = &sectionID
+	}
+
+	questionIDs, err := createQuestions(tx, surveyID, questions)
+	if err != nil {
+		return err
+	}
+
+	// Positions of the pages, to check that rules only jump forward.
+	position := make(map[uint]int, len(sections))
+	for i, page := range logic.Pages(sections, nil) {
+		position[page.SectionID] = i
+	}
+	questionPage := make(map[uint]int, len(questions))
+	for _, question := range questions {
+		if question.SectionID != nil {
+			questionPage[question.ID] = position[*question.SectionID]
+		}
+	}
+
+	for i := range sections {
+		section := &sections[i]
+		for j := range section.Rules {
+			rule := &section.Rules[j]
+			if !logic.ValidOperator(rule.Operator) {
+				return surveyDefinitionError{fmt.Sprintf("unknown page rule operator %q", rule.Operator)}
+			}
+			questionID, ok := questionIDs[rule.QuestionID]
+			if !ok || questionPage[questionID] > position[section.ID] {
+				return surveyDefinitionError{fmt.Sprintf("page rule of section %q references a question that is not on this or an earlier page", section.Title)}
+			}
+			if rule.GoToSectionID != nil {
+				target, ok := sectionIDs[*rule.GoToSectionID]
+				if !ok || position[target] <= position[section.ID] {
+					return surveyDefinitionError{fmt.Sprintf("page rule of section %q must jump to a later section", section.Title)}
+				}
+				rule.GoToSectionID = &target
+			}
+
+			rule.ID = 0
+			rule.SectionID = section.ID
+			rule.QuestionID = questionID
+			if err := tx.Create(rule).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// createQuestions inserts questions together with their options and
+// conditions. Conditions reference other questions by the IDs the client sent
+// (existing IDs on update and duplicate, or any temporary IDs on create); those
+// references are rewritten to the IDs of the newly created rows. It returns
+// the mapping from client IDs to new IDs.
+func createQuestions(tx *gorm.DB, surveyID uint, questions []models.Question) (map[uint]uint, error) {
+	idMap := make(map[uint]uint, len(questions))
+	for i := range questions {
+		question := &questions[i]
+		clientID := question.ID
+
+		switch {
+		case question.Type == "matrix" && (len(question.Rows) == 0 || len(question.Options) == 0):
+			return nil, surveyDefinitionError{fmt.Sprintf("matrix question %q needs rows and columns", question.Text)}
+		case question.Type == "ranking" && len(question.Options) < 2:
+			return nil, surveyDefinitionError{fmt.Sprintf("ranking question %q needs at least two options", question.Text)}
+		}
+
+		question.ID = 0 // Ensure new record is created
+		question.SurveyID = surveyID
+		if err := tx.Omit("Options", "Rows", "Conditions").Create(question).Error; err != nil {
+			return nil, err
+		}
+		if clientID != 0 {
+			idMap[clientID] = question.ID
+		}
+
+		for j := range question.Options {
+			question.Options[j].ID = 0
+			question.Options[j].QuestionID = question.ID
+			if err := tx.Create(&question.Options[j]).Error; err != nil {
+				return nil, err
+			}
+		}
+		for j := range question.Rows {
+			question.Rows[j].ID = 0
+			question.Rows[j].QuestionID = question.ID
+			if err := tx.Create(&question.Rows[j]).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i := range questions {
+		question := &questions[i]
+		for j := range question.Conditions {
+			condition := &question.Conditions[j]
+			if !logic.ValidOperator(condition.Operator) {
+				return nil, surveyDefinitionError{fmt.Sprintf("unknown condition operator %q", condition.Operator)}
+			}
+			dependentOnID, ok := idMap[condition.DependentOnID]
+			if !ok || dependentOnID == question.ID {
+				return nil, surveyDefinitionError{fmt.Sprintf("condition on question %q references an unknown question", question.Text)}
+			}
+
+			condition.ID = 0
+			condition.QuestionID = question.ID
+			condition.DependentOnID = dependentOnID
+			if err := tx.Create(condition).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return idMap, nil
+}
+
 func withDefaultTime(t *time.Time, defaultTime time.Time) *time.Time {
 	if t == nil {
 		return &defaultTime
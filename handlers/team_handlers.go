@@ -2,12 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/nikhilsahni7/SurveyX/authz"
 	"github.com/nikhilsahni7/SurveyX/db"
 	"github.com/nikhilsahni7/SurveyX/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func CreateTeam(w http.ResponseWriter, r *http.Request) {
@@ -21,7 +26,16 @@ func CreateTeam(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(uint)
 	team.OwnerID = userID
 
-	if err := db.DB.Create(&team).Error; err != nil {
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Users", "Surveys").Create(&team).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TeamMember{
+			UserID: userID,
+			TeamID: team.ID,
+			Role:   authz.RoleOwner,
+		}).Error
+	}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -50,13 +64,23 @@ func GetTeam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID := r.Context().Value("userID").(uint)
 	var team models.Team
-	if err := db.DB.Preload("Users").First(&team, teamID).Error; err != nil {
+	if _, err := authz.Team(db.DB.Preload("Users").Preload("Surveys"), userID, uint(teamID), authz.ActionViewTeam, &team); err != nil {
 		http.Error(w, "Team not found", http.StatusNotFound)
 		return
 	}
 
-	json.NewEncoder(w).Encode(team)
+	members, err := listTeamMembers(team.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		models.Team
+		Members []teamMemberView `json:"members"`
+	}{team, members})
 }
 
 func UpdateTeam(w http.ResponseWriter, r *http.Request) {
@@ -74,8 +98,9 @@ func UpdateTeam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID := r.Context().Value("userID").(uint)
 	var team models.Team
-	if err := db.DB.First(&team, teamID).Error; err != nil {
+	if _, err := authz.Team(db.DB, userID, uint(teamID), authz.ActionManageTeam, &team); err != nil {
 		http.Error(w, "Team not found", http.StatusNotFound)
 		return
 	}
@@ -100,26 +125,64 @@ func AddTeamMember(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
 		Email string `json:"email"`
+		Role  string `json:"role"`
 	}
 	err = json.NewDecoder(r.Body).Decode(&input)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if input.Role == "" {
+		input.Role = authz.RoleViewer
+	}
 
+	currentUserID := r.Context().Value("userID").(uint)
 	var team models.Team
-	if err := db.DB.First(&team, teamID).Error; err != nil {
+	actorRole, err := authz.Team(db.DB, currentUserID, uint(teamID), authz.ActionManageMembers, &team)
+	if err != nil {
 		http.Error(w, "Team not found", http.StatusNotFound)
 		return
 	}
 
+	if !canAssignRole(actorRole, input.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	// People without an account get an invitation they can accept on signup.
 	var user models.User
 	if err := db.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		invitation, err := inviteToTeam(r.Context(), &team, input.Email, input.Role, currentUserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":    "Invitation sent",
+			"invitation": invitation,
+		})
 		return
 	}
 
-	if err := db.DB.Model(&team).Association("Users").Append(&user); err != nil {
+	if _, err := authz.TeamRole(db.DB, user.ID, team.ID); err == nil {
+		http.Error(w, "User is already a member of this team", http.StatusConflict)
+		return
+	}
+
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		member := models.TeamMember{UserID: user.ID, TeamID: team.ID, Role: input.Role}
+		if err := tx.Create(&member).Error; err != nil {
+			return err
+		}
+		return publishMemberAdded(tx, &member)
+	}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -142,19 +205,35 @@ func RemoveTeamMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Members may always leave a team; removing others needs manage_members.
+	currentUserID := r.Context().Value("userID").(uint)
+	action := authz.ActionManageMembers
+	if uint(userID) == currentUserID {
+		action = authz.ActionViewTeam
+	}
+
 	var team models.Team
-	if err := db.DB.First(&team, teamID).Error; err != nil {
+	actorRole, err := authz.Team(db.DB, currentUserID, uint(teamID), action, &team)
+	if err != nil {
 		http.Error(w, "Team not found", http.StatusNotFound)
 		return
 	}
 
-	var user models.User
-	if err := db.DB.First(&user, userID).Error; err != nil {
+	memberRole, err := authz.TeamRole(db.DB, uint(userID), team.ID)
+	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
+	if memberRole == authz.RoleOwner {
+		http.Error(w, "The team owner cannot be removed; transfer ownership first", http.StatusConflict)
+		return
+	}
+	if !authz.Outranks(actorRole, memberRole) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 
-	if err := db.DB.Model(&team).Association("Users").Delete(&user); err != nil {
+	if err := db.DB.Where("team_id = ? AND user_id = ?", team.ID, userID).Delete(&models.TeamMember{}).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -162,3 +241,138 @@ func RemoveTeamMember(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "User removed from team successfully"})
 }
+
+func UpdateTeamMemberRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	teamID, err := strconv.ParseUint(vars["teamId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currentUserID := r.Context().Value("userID").(uint)
+	var team models.Team
+	actorRole, err := authz.Team(db.DB, currentUserID, uint(teamID), authz.ActionManageMembers, &team)
+	if err != nil {
+		http.Error(w, "Team not found", http.StatusNotFound)
+		return
+	}
+
+	memberRole, err := authz.TeamRole(db.DB, uint(userID), team.ID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if memberRole == authz.RoleOwner {
+		http.Error(w, "The owner's role can only change by transferring ownership", http.StatusConflict)
+		return
+	}
+	if !authz.Outranks(actorRole, memberRole) || !canAssignRole(actorRole, input.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.DB.Model(&models.TeamMember{}).Where("team_id = ? AND user_id = ?", team.ID, userID).Update("role", input.Role).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Member role updated successfully"})
+}
+
+// TransferTeamOwnership hands the team over to another member. The previous
+// owner stays in the team as an admin.
+func TransferTeamOwnership(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	teamID, err := strconv.ParseUint(vars["teamId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		UserID uint `json:"userId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currentUserID := r.Context().Value("userID").(uint)
+	var team models.Team
+	actorRole, err := authz.Team(db.DB, currentUserID, uint(teamID), authz.ActionViewTeam, &team)
+	if err != nil {
+		http.Error(w, "Team not found", http.StatusNotFound)
+		return
+	}
+	if actorRole != authz.RoleOwner {
+		http.Error(w, "Only the team owner can transfer ownership", http.StatusForbidden)
+		return
+	}
+
+	if input.UserID == currentUserID {
+		http.Error(w, "You already own this team", http.StatusBadRequest)
+		return
+	}
+	if _, err := authz.TeamRole(db.DB, input.UserID, team.ID); err != nil {
+		http.Error(w, "The new owner must be a member of the team", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&team).Update("owner_id", input.UserID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.TeamMember{}).Where("team_id = ? AND user_id = ?", team.ID, input.UserID).Update("role", authz.RoleOwner).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "team_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"role": authz.RoleAdmin}),
+		}).Create(&models.TeamMember{UserID: currentUserID, TeamID: team.ID, Role: authz.RoleAdmin}).Error
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Team ownership transferred successfully"})
+}
+
+type teamMemberView struct {
+	UserID   uint      `json:"userId"`
+	Email    string    `json:"email"`
+	Name     string    `json:"name"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+func listTeamMembers(teamID uint) ([]teamMemberView, error) {
+	members := make([]teamMemberView, 0)
+	err := db.DB.Table("user_teams").
+		Select("user_teams.user_id, users.email, users.name, user_teams.role, user_teams.created_at AS joined_at").
+		Joins("JOIN users ON users.id = user_teams.user_id AND users.deleted_at IS NULL").
+		Where("user_teams.team_id = ?", teamID).
+		Order("user_teams.created_at").
+		Scan(&members).Error
+	return members, err
+}
+
+// canAssignRole reports whether a member with actorRole may give role to
+// someone. Ownership is only ever handed over by TransferTeamOwnership.
+func canAssignRole(actorRole, role string) bool {
+	return authz.ValidRole(role) && role != authz.RoleOwner && authz.Outranks(actorRole, role)
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nikhilsahni7/SurveyX/authz"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTestUser creates a user with an email address that is unique across
+// test runs.
+func createTestUser(t *testing.T, name string) models.User {
+	t.Helper()
+	user := models.User{
+		Email: fmt.Sprintf("%s-%d@example.com", name, time.Now().UnixNano()),
+		Name:  name,
+	}
+	require.NoError(t, db.DB.Create(&user).Error)
+	return user
+}
+
+// createTestTeam creates a team owned by owner with the given members and
+// their roles.
+func createTestTeam(t *testing.T, owner models.User, members map[uint]string) models.Team {
+	t.Helper()
+	team := models.Team{Name: "Test Team", OwnerID: owner.ID}
+	require.NoError(t, db.DB.Omit("Users", "Surveys").Create(&team).Error)
+	for userID, role := range members {
+		require.NoError(t, db.DB.Create(&models.TeamMember{UserID: userID, TeamID: team.ID, Role: role}).Error)
+	}
+	return team
+}
+
+// serveAs sends a request with body encoded as JSON through router, signed in
+// as userID unless it is zero.
+func serveAs(router http.Handler, method, path string, body interface{}, userID uint) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+	if userID != 0 {
+		req = req.WithContext(setUserIDContext(req.Context(), userID))
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTeamHandlers(t *testing.T) {
+	testDB := setupTestDB()
+	db.DB = testDB
+	defer func() {
+		sqlDB, _ := testDB.DB()
+		sqlDB.Close()
+	}()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/teams/{teamId}", GetTeam).Methods("GET")
+	router.HandleFunc("/surveys", CreateSurvey).Methods("POST")
+	router.HandleFunc("/surveys", ListSurveys).Methods("GET")
+	router.HandleFunc("/surveys/{id}/move", MoveSurvey).Methods("POST")
+
+	owner := createTestUser(t, "owner")
+	admin := createTestUser(t, "admin")
+	editor := createTestUser(t, "editor")
+	viewer := createTestUser(t, "viewer")
+	outsider := createTestUser(t, "outsider")
+	team := createTestTeam(t, owner, map[uint]string{admin.ID: authz.RoleAdmin, editor.ID: authz.RoleEditor, viewer.ID: authz.RoleViewer})
+
+	listSurveys := func(t *testing.T, userID uint, scope string) []uint {
+		rr := serveAs(router, "GET", "/surveys?scope="+scope, nil, userID)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var surveys []models.Survey
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &surveys))
+		ids := make([]uint, 0, len(surveys))
+		for _, s := range surveys {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+	move := func(surveyID uint, teamID *uint, userID uint) int {
+		return serveAs(router, "POST", fmt.Sprintf("/surveys/%d/move", surveyID), map[string]interface{}{"teamId": teamID}, userID).Code
+	}
+
+	// Test that every member can get the team, not only its owner
+	t.Run("GetTeam", func(t *testing.T) {
+		for _, tt := range []struct {
+			name string
+			user models.User
+			want int
+		}{
+			{"owner", owner, http.StatusOK},
+			{"admin", admin, http.StatusOK},
+			{"viewer", viewer, http.StatusOK},
+			{"outsider", outsider, http.StatusNotFound},
+		} {
+			req, _ := http.NewRequest("GET", fmt.Sprintf("/teams/%d", team.ID), nil)
+			req = req.WithContext(setUserIDContext(req.Context(), tt.user.ID))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.want, rr.Code, tt.name)
+		}
+	})
+
+	// Test that the members listed with the team leave out password hashes
+	t.Run("GetTeamHidesPasswordHashes", func(t *testing.T) {
+		require.NoError(t, db.DB.Model(&models.User{}).Where("id = ?", admin.ID).Update("password_hash", "hash-of-admin").Error)
+
+		rr := serveAs(router, "GET", fmt.Sprintf("/teams/%d", team.ID), nil, owner.ID)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "PasswordHash")
+		assert.NotContains(t, rr.Body.String(), "hash-of-admin")
+	})
+
+	// Test that only members who can edit surveys create them in the team
+	t.Run("CreateSurveyInTeam", func(t *testing.T) {
+		for _, tt := range []struct {
+			name string
+			user models.User
+			want int
+		}{
+			{"editor", editor, http.StatusCreated},
+			{"viewer", viewer, http.StatusNotFound},
+			{"outsider", outsider, http.StatusNotFound},
+		} {
+			survey := models.Survey{Title: "Team Survey by " + tt.name, TeamID: &team.ID}
+			rr := serveAs(router, "POST", "/surveys", survey, tt.user.ID)
+			assert.Equal(t, tt.want, rr.Code, tt.name)
+		}
+	})
+
+	// Test the scope filter of ListSurveys
+	t.Run("ListSurveysScope", func(t *testing.T) {
+		personal := models.Survey{UserID: viewer.ID, Title: "Personal Survey"}
+		require.NoError(t, db.DB.Create(&personal).Error)
+		teamSurvey := models.Survey{UserID: owner.ID, TeamID: &team.ID, Title: "Team Survey"}
+		require.NoError(t, db.DB.Create(&teamSurvey).Error)
+		teamScope := fmt.Sprintf("team:%d", team.ID)
+
+		mine := listSurveys(t, viewer.ID, "mine")
+		assert.Contains(t, mine, personal.ID)
+		assert.NotContains(t, mine, teamSurvey.ID)
+
+		inTeam := listSurveys(t, viewer.ID, teamScope)
+		assert.Contains(t, inTeam, teamSurvey.ID)
+		assert.NotContains(t, inTeam, personal.ID)
+
+		all := listSurveys(t, viewer.ID, "all")
+		assert.Contains(t, all, personal.ID)
+		assert.Contains(t, all, teamSurvey.ID)
+
+		assert.Empty(t, listSurveys(t, outsider.ID, teamScope))
+		assert.Equal(t, http.StatusBadRequest, serveAs(router, "GET", "/surveys?scope=everything", nil, viewer.ID).Code)
+	})
+
+	// Test moving a survey into a team and back out of it
+	t.Run("MoveSurvey", func(t *testing.T) {
+		survey := models.Survey{UserID: editor.ID, Title: "Survey to Move"}
+		require.NoError(t, db.DB.Create(&survey).Error)
+
+		// Viewers cannot add surveys to the team.
+		viewerSurvey := models.Survey{UserID: viewer.ID, Title: "Viewer Survey"}
+		require.NoError(t, db.DB.Create(&viewerSurvey).Error)
+		assert.Equal(t, http.StatusNotFound, move(viewerSurvey.ID, &team.ID, viewer.ID))
+
+		assert.Equal(t, http.StatusOK, move(survey.ID, &team.ID, editor.ID))
+		assert.Contains(t, listSurveys(t, viewer.ID, fmt.Sprintf("team:%d", team.ID)), survey.ID)
+
+		// Editors cannot delete team surveys, so they cannot take them out.
+		assert.Equal(t, http.StatusNotFound, move(survey.ID, nil, editor.ID))
+		assert.Equal(t, http.StatusNotFound, move(survey.ID, nil, outsider.ID))
+
+		assert.Equal(t, http.StatusOK, move(survey.ID, nil, admin.ID))
+		var moved models.Survey
+		require.NoError(t, db.DB.First(&moved, survey.ID).Error)
+		assert.Nil(t, moved.TeamID)
+		assert.Equal(t, admin.ID, moved.UserID)
+		assert.Contains(t, listSurveys(t, admin.ID, "mine"), survey.ID)
+	})
+}
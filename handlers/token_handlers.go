@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/auth"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/models"
+)
+
+// maxAccessTokenDays bounds how long an access token can stay valid.
+const maxAccessTokenDays = 365
+
+// accessTokenView is the API representation of an access token. The token
+// itself is only returned once, when it is created.
+type accessTokenView struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func newAccessTokenView(t *models.AccessToken) accessTokenView {
+	return accessTokenView{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     strings.Fields(t.Scopes),
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
+
+func ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uint)
+
+	var tokens []models.AccessToken
+	if err := db.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]accessTokenView, 0, len(tokens))
+	for i := range tokens {
+		views = append(views, newAccessTokenView(&tokens[i]))
+	}
+	json.NewEncoder(w).Encode(views)
+}
+
+// CreateAccessToken issues a token with the requested scopes. expiresInDays
+// defaults to 90; 0 creates a token that never expires.
+func CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays *int     `json:"expiresInDays"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	if len(input.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range input.Scopes {
+		if !auth.ValidScope(scope) {
+			http.Error(w, "Unknown scope: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	days := 90
+	if input.ExpiresInDays != nil {
+		days = *input.ExpiresInDays
+	}
+	if days < 0 || days > maxAccessTokenDays {
+		http.Error(w, "expiresInDays must be between 0 and 365", http.StatusBadRequest)
+		return
+	}
+	var expiresAt *time.Time
+	if days > 0 {
+		t := time.Now().AddDate(0, 0, days)
+		expiresAt = &t
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	accessToken, token, err := auth.CreateAccessToken(userID, input.Name, input.Scopes, expiresAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	view := newAccessTokenView(accessToken)
+	view.Token = token
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(view)
+}
+
+func DeleteAccessToken(w http.ResponseWriter, r *http.Request) {
+	id := parseUintParam(r, "id")
+	userID := r.Context().Value("userID").(uint)
+
+	result := db.DB.Where("user_id = ?", userID).Delete(&models.AccessToken{}, id)
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Access token not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
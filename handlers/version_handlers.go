@@ -0,0 +1,493 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nikhilsahni7/SurveyX/authz"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"gorm.io/gorm"
+)
+
+// versionView is the API representation of a survey version.
+type versionView struct {
+	ID          uint              `json:"id"`
+	SurveyID    uint              `json:"surveyId"`
+	Version     int               `json:"version"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	Sections    []models.Section  `json:"sections,omitempty"`
+	Questions   []models.Question `json:"questions,omitempty"`
+}
+
+func ListSurveyVersions(w http.ResponseWriter, r *http.Request) {
+	surveyID := parseUintParam(r, "id")
+	userID := r.Context().Value("userID").(uint)
+
+	if err := authz.CheckSurvey(db.DB, userID, surveyID, authz.ActionViewSurvey); err != nil {
+		http.Error(w, "Survey not found", http.StatusNotFound)
+		return
+	}
+
+	var versions []models.SurveyVersion
+	if err := db.DB.Where("survey_id = ?", surveyID).Order("version").Find(&versions).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]versionView, 0, len(versions))
+	for _, v := range versions {
+		views = append(views, versionView{
+			ID:          v.ID,
+			SurveyID:    v.SurveyID,
+			Version:     v.Version,
+			Title:       v.Title,
+			Description: v.Description,
+			CreatedAt:   v.CreatedAt,
+		})
+	}
+
+	json.NewEncoder(w).Encode(views)
+}
+
+func GetSurveyVersion(w http.ResponseWriter, r *http.Request) {
+	surveyID := parseUintParam(r, "id")
+	version, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	if err := authz.CheckSurvey(db.DB, userID, surveyID, authz.ActionViewSurvey); err != nil {
+		http.Error(w, "Survey not found", http.StatusNotFound)
+		return
+	}
+
+	view, err := loadVersion(db.DB, surveyID, version)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(view)
+}
+
+// DiffSurveyVersions compares two versions given by the from and to query
+// parameters. Questions are matched by their position in the survey.
+func DiffSurveyVersions(w http.ResponseWriter, r *http.Request) {
+	surveyID := parseUintParam(r, "id")
+	from, errFrom := strconv.Atoi(r.URL.Query().Get("from"))
+	to, errTo := strconv.Atoi(r.URL.Query().Get("to"))
+	if errFrom != nil || errTo != nil {
+		http.Error(w, "from and to must be version numbers", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	if err := authz.CheckSurvey(db.DB, userID, surveyID, authz.ActionViewSurvey); err != nil {
+		http.Error(w, "Survey not found", http.StatusNotFound)
+		return
+	}
+
+	fromView, err := loadVersion(db.DB, surveyID, from)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	toView, err := loadVersion(db.DB, surveyID, to)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(diffVersions(fromView, toView))
+}
+
+func writeVersionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func loadVersion(tx *gorm.DB, surveyID uint, version int) (*versionView, error) {
+	var v models.SurveyVersion
+	if err := tx.Where("survey_id = ? AND version = ?", surveyID, version).First(&v).Error; err != nil {
+		return nil, err
+	}
+
+	view := &versionView{
+		ID:          v.ID,
+		SurveyID:    v.SurveyID,
+		Version:     v.Version,
+		Title:       v.Title,
+		Description: v.Description,
+		CreatedAt:   v.CreatedAt,
+	}
+	if err := json.Unmarshal([]byte(v.Questions), &view.Questions); err != nil {
+		return nil, err
+	}
+	if v.Sections != "" {
+		if err := json.Unmarshal([]byte(v.Sections), &view.Sections); err != nil {
+			return nil, err
+		}
+	}
+	return view, nil
+}
+
+// snapshotSurvey freezes the current revision of a survey as an immutable
+// version. It does nothing if that version has already been snapshotted.
+func snapshotSurvey(tx *gorm.DB, survey *models.Survey) error {
+	exists, err := versionExists(tx, survey.ID, survey.Version)
+	if err != nil || exists {
+		return err
+	}
+
+	var questions []models.Question
+	if err := tx.Where("survey_id = ?", survey.ID).Preload("Options").Preload("Rows").Preload("Conditions").Find(&questions).Error; err != nil {
+		return err
+	}
+	sortQuestions(questions)
+
+	encoded, err := json.Marshal(questions)
+	if err != nil {
+		return err
+	}
+
+	var sections []models.Section
+	if err := tx.Where("survey_id = ?", survey.ID).Preload("Rules").Order("\"order\", id").Find(&sections).Error; err != nil {
+		return err
+	}
+	encodedSections, err := json.Marshal(sections)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&models.SurveyVersion{
+		SurveyID:    survey.ID,
+		Version:     survey.Version,
+		Title:       survey.Title,
+		Description: survey.Description,
+		Sections:    string(encodedSections),
+		Questions:   string(encoded),
+	}).Error
+}
+
+func versionExists(tx *gorm.DB, surveyID uint, version int) (bool, error) {
+	var count int64
+	err := tx.Model(&models.SurveyVersion{}).Where("survey_id = ? AND version = ?", surveyID, version).Count(&count).Error
+	return count > 0, err
+}
+
+// answeredQuestions returns every question that responses may reference: the
+// live questions plus the question sets of the snapshotted versions that were
+// answered. Question IDs are never reused across versions, so answers resolve
+// to the question they were given for. It also maps each question ID to the
+// version the question was taken from.
+func answeredQuestions(tx *gorm.DB, survey *models.Survey) ([]models.Question, map[uint]int, error) {
+	versions := make(map[int]bool)
+	for _, response := range survey.Responses {
+		if response.Version != 0 {
+			versions[response.Version] = true
+		}
+	}
+
+	questionVersions := make(map[uint]int)
+	questions := make([]models.Question, 0, len(survey.Questions))
+	add := func(list []models.Question, version int) {
+		for _, q := range list {
+			if _, seen := questionVersions[q.ID]; !seen {
+				questionVersions[q.ID] = version
+				questions = append(questions, q)
+			}
+		}
+	}
+
+	numbers := make([]int, 0, len(versions))
+	for v := range versions {
+		numbers = append(numbers, v)
+	}
+	sort.Ints(numbers)
+
+	for _, number := range numbers {
+		view, err := loadVersion(tx, survey.ID, number)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		add(view.Questions, number)
+	}
+	add(survey.Questions, survey.Version)
+
+	return questions, questionVersions, nil
+}
+
+func sortQuestions(questions []models.Question) {
+	sort.SliceStable(questions, func(i, j int) bool {
+		return questions[i].Order < questions[j].Order
+	})
+}
+
+type valueChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type questionDiff struct {
+	Position int                    `json:"position"`
+	Change   string                 `json:"change"`
+	From     *models.Question       `json:"from,omitempty"`
+	To       *models.Question       `json:"to,omitempty"`
+	Fields   map[string]valueChange `json:"fields,omitempty"`
+}
+
+type sectionDiff struct {
+	Position int                    `json:"position"`
+	Change   string                 `json:"change"`
+	From     *models.Section        `json:"from,omitempty"`
+	To       *models.Section        `json:"to,omitempty"`
+	Fields   map[string]valueChange `json:"fields,omitempty"`
+}
+
+type versionDiff struct {
+	From      int                    `json:"from"`
+	To        int                    `json:"to"`
+	Fields    map[string]valueChange `json:"fields,omitempty"`
+	Sections  []sectionDiff          `json:"sections,omitempty"`
+	Questions []questionDiff         `json:"questions"`
+}
+
+// versionPositions maps the question and section IDs of a version to their
+// 1-based positions, which is what the diff compares since IDs change
+// between versions.
+type versionPositions struct {
+	questions map[uint]int
+	sections  map[uint]int
+}
+
+func positionsOf(view *versionView) versionPositions {
+	positions := versionPositions{
+		questions: make(map[uint]int, len(view.Questions)),
+		sections:  make(map[uint]int, len(view.Sections)),
+	}
+	for i, q := range view.Questions {
+		positions.questions[q.ID] = i + 1
+	}
+	for i, s := range view.Sections {
+		positions.sections[s.ID] = i + 1
+	}
+	return positions
+}
+
+func diffVersions(from, to *versionView) versionDiff {
+	diff := versionDiff{
+		From:      from.Version,
+		To:        to.Version,
+		Fields:    make(map[string]valueChange),
+		Questions: make([]questionDiff, 0),
+	}
+	if from.Title != to.Title {
+		diff.Fields["title"] = valueChange{from.Title, to.Title}
+	}
+	if from.Description != to.Description {
+		diff.Fields["description"] = valueChange{from.Description, to.Description}
+	}
+
+	sortQuestions(from.Questions)
+	sortQuestions(to.Questions)
+	sortSections(from.Sections)
+	sortSections(to.Sections)
+	fromPositions, toPositions := positionsOf(from), positionsOf(to)
+
+	for i := 0; i < len(from.Sections) || i < len(to.Sections); i++ {
+		switch {
+		case i >= len(to.Sections):
+			diff.Sections = append(diff.Sections, sectionDiff{Position: i + 1, Change: "removed", From: &from.Sections[i]})
+		case i >= len(from.Sections):
+			diff.Sections = append(diff.Sections, sectionDiff{Position: i + 1, Change: "added", To: &to.Sections[i]})
+		default:
+			if fields := diffSection(from.Sections[i], to.Sections[i], fromPositions, toPositions); len(fields) > 0 {
+				diff.Sections = append(diff.Sections, sectionDiff{Position: i + 1, Change: "modified", Fields: fields})
+			}
+		}
+	}
+
+	for i := 0; i < len(from.Questions) || i < len(to.Questions); i++ {
+		switch {
+		case i >= len(to.Questions):
+			diff.Questions = append(diff.Questions, questionDiff{Position: i + 1, Change: "removed", From: &from.Questions[i]})
+		case i >= len(from.Questions):
+			diff.Questions = append(diff.Questions, questionDiff{Position: i + 1, Change: "added", To: &to.Questions[i]})
+		default:
+			if fields := diffQuestion(from.Questions[i], to.Questions[i], fromPositions, toPositions); len(fields) > 0 {
+				diff.Questions = append(diff.Questions, questionDiff{Position: i + 1, Change: "modified", Fields: fields})
+			}
+		}
+	}
+
+	return diff
+}
+
+// diffQuestion compares two questions. Conditions and the section of a
+// question refer to other questions and sections by position, since IDs
+// change between versions.
+func diffQuestion(a, b models.Question, positionsA, positionsB versionPositions) map[string]valueChange {
+	fields := make(map[string]valueChange)
+	if a.Text != b.Text {
+		fields["text"] = valueChange{a.Text, b.Text}
+	}
+	if a.Type != b.Type {
+		fields["type"] = valueChange{a.Type, b.Type}
+	}
+	if a.IsRequired != b.IsRequired {
+		fields["isRequired"] = valueChange{a.IsRequired, b.IsRequired}
+	}
+	if a.AllowMultiple != b.AllowMultiple {
+		fields["allowMultiple"] = valueChange{a.AllowMultiple, b.AllowMultiple}
+	}
+	if a.ShuffleOptions != b.ShuffleOptions {
+		fields["shuffleOptions"] = valueChange{a.ShuffleOptions, b.ShuffleOptions}
+	}
+	if sectionA, sectionB := sectionPosition(a.SectionID, positionsA), sectionPosition(b.SectionID, positionsB); sectionA != sectionB {
+		fields["section"] = valueChange{sectionA, sectionB}
+	}
+	if !equalIntPtr(a.MinValue, b.MinValue) {
+		fields["minValue"] = valueChange{a.MinValue, b.MinValue}
+	}
+	if !equalIntPtr(a.MaxValue, b.MaxValue) {
+		fields["maxValue"] = valueChange{a.MaxValue, b.MaxValue}
+	}
+
+	optionsA, optionsB := optionLabels(a.Options), optionLabels(b.Options)
+	if !equalStrings(optionsA, optionsB) {
+		fields["options"] = valueChange{optionsA, optionsB}
+	}
+	rowsA, rowsB := rowLabels(a.Rows), rowLabels(b.Rows)
+	if !equalStrings(rowsA, rowsB) {
+		fields["rows"] = valueChange{rowsA, rowsB}
+	}
+	conditionsA, conditionsB := conditionLabels(a.Conditions, positionsA), conditionLabels(b.Conditions, positionsB)
+	if !equalStrings(conditionsA, conditionsB) {
+		fields["conditions"] = valueChange{conditionsA, conditionsB}
+	}
+	return fields
+}
+
+// diffSection compares two sections. Page rules refer to questions and
+// sections by position, like diffQuestion.
+func diffSection(a, b models.Section, positionsA, positionsB versionPositions) map[string]valueChange {
+	fields := make(map[string]valueChange)
+	if a.Title != b.Title {
+		fields["title"] = valueChange{a.Title, b.Title}
+	}
+	if a.Description != b.Description {
+		fields["description"] = valueChange{a.Description, b.Description}
+	}
+	if a.ShuffleQuestions != b.ShuffleQuestions {
+		fields["shuffleQuestions"] = valueChange{a.ShuffleQuestions, b.ShuffleQuestions}
+	}
+
+	rulesA, rulesB := ruleLabels(a.Rules, positionsA), ruleLabels(b.Rules, positionsB)
+	if !equalStrings(rulesA, rulesB) {
+		fields["rules"] = valueChange{rulesA, rulesB}
+	}
+	return fields
+}
+
+func sortSections(sections []models.Section) {
+	sort.SliceStable(sections, func(i, j int) bool {
+		return sections[i].Order < sections[j].Order
+	})
+}
+
+// sectionPosition returns the position of a section, or 0 for questions
+// outside any section.
+func sectionPosition(sectionID *uint, positions versionPositions) int {
+	if sectionID == nil {
+		return 0
+	}
+	return positions.sections[*sectionID]
+}
+
+// ruleLabels describes page rules in the order they are tried, as strings
+// such as "question 2 equals yes: go to section 3".
+func ruleLabels(rules []models.PageRule, positions versionPositions) []string {
+	sorted := append([]models.PageRule(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Order < sorted[j].Order
+	})
+
+	labels := make([]string, 0, len(sorted))
+	for _, r := range sorted {
+		target := "go to the end"
+		if r.GoToSectionID != nil {
+			target = fmt.Sprintf("go to section %d", positions.sections[*r.GoToSectionID])
+		}
+		labels = append(labels, fmt.Sprintf("question %d %s %s: %s", positions.questions[r.QuestionID], r.Operator, r.Value, target))
+	}
+	return labels
+}
+
+// conditionLabels describes conditions as sorted strings such as
+// "group 0: question 2 equals yes".
+func conditionLabels(conditions []models.Condition, positions versionPositions) []string {
+	labels := make([]string, 0, len(conditions))
+	for _, c := range conditions {
+		labels = append(labels, fmt.Sprintf("group %d: question %d %s %s", c.Group, positions.questions[c.DependentOnID], c.Operator, c.DependentOnValue))
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// optionLabels describes options as strings such as "Yes=yes", marking the
+// ones that stay in place when options are shuffled with " (pinned)".
+func optionLabels(options []models.Option) []string {
+	labels := make([]string, 0, len(options))
+	for _, o := range options {
+		label := o.Text + "=" + o.Value
+		if o.Pinned {
+			label += " (pinned)"
+		}
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+func rowLabels(rows []models.MatrixRow) []string {
+	labels := make([]string, 0, len(rows))
+	for _, r := range rows {
+		labels = append(labels, r.Text+"="+r.Value)
+	}
+	return labels
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalIntPtr(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/nikhilsahni7/SurveyX/db"
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestDiffVersionsComparesConditions(t *testing.T) {
+	question := func(id uint, order int) models.Question {
+		q := models.Question{Text: "Question", Type: "text", Order: order}
+		q.ID = id
+		return q
+	}
+	condition := func(dependsOn uint, operator, value string) models.Condition {
+		return models.Condition{DependentOnID: dependsOn, Operator: operator, DependentOnValue: value}
+	}
+
+	// Question IDs differ between versions, so only changes to what the
+	// condition checks should be reported.
+	from := &versionView{Version: 1, Questions: []models.Question{question(1, 1), question(2, 2)}}
+	from.Questions[1].Conditions = []models.Condition{condition(1, "equals", "yes")}
+	same := &versionView{Version: 2, Questions: []models.Question{question(11, 1), question(12, 2)}}
+	same.Questions[1].Conditions = []models.Condition{condition(11, "equals", "yes")}
+	changed := &versionView{Version: 3, Questions: []models.Question{question(21, 1), question(22, 2)}}
+	changed.Questions[1].Conditions = []models.Condition{condition(21, "not equals", "yes")}
+
+	assert.Empty(t, diffVersions(from, same).Questions)
+
+	diff := diffVersions(from, changed)
+	if assert.Len(t, diff.Questions, 1) {
+		assert.Equal(t, 2, diff.Questions[0].Position)
+		assert.Equal(t, valueChange{
+			[]string{"group 0: question 1 equals yes"},
+			[]string{"group 0: question 1 not equals yes"},
+		}, diff.Questions[0].Fields["conditions"])
+	}
+}
+
+func TestDiffVersionsComparesSections(t *testing.T) {
+	section := func(id uint, order int, rules ...models.PageRule) models.Section {
+		s := models.Section{Title: "Section", Order: order, Rules: rules}
+		s.ID = id
+		return s
+	}
+	question := func(id, sectionID uint, order int) models.Question {
+		q := models.Question{Text: "Question", Type: "text", SectionID: &sectionID, Order: order}
+		q.ID = id
+		return q
+	}
+	rule := func(questionID uint, value string, goTo uint) models.PageRule {
+		return models.PageRule{QuestionID: questionID, Operator: "equals", Value: value, GoToSectionID: &goTo}
+	}
+
+	// Section and question IDs differ between versions, so only changes to
+	// where questions sit and where rules lead should be reported.
+	from := &versionView{
+		Version:   1,
+		Sections:  []models.Section{section(1, 1, rule(1, "yes", 2)), section(2, 2)},
+		Questions: []models.Question{question(1, 1, 1), question(2, 2, 2)},
+	}
+	same := &versionView{
+		Version:   2,
+		Sections:  []models.Section{section(11, 1, rule(11, "yes", 12)), section(12, 2)},
+		Questions: []models.Question{question(11, 11, 1), question(12, 12, 2)},
+	}
+	changed := &versionView{
+		Version:   3,
+		Sections:  []models.Section{section(21, 1, rule(21, "no", 22)), section(22, 2)},
+		Questions: []models.Question{question(21, 21, 1), question(22, 21, 2)},
+	}
+
+	diff := diffVersions(from, same)
+	assert.Empty(t, diff.Sections)
+	assert.Empty(t, diff.Questions)
+
+	diff = diffVersions(from, changed)
+	if assert.Len(t, diff.Sections, 1) {
+		assert.Equal(t, 1, diff.Sections[0].Position)
+		assert.Equal(t, valueChange{
+			[]string{"question 1 equals yes: go to section 2"},
+			[]string{"question 1 equals no: go to section 2"},
+		}, diff.Sections[0].Fields["rules"])
+	}
+	if assert.Len(t, diff.Questions, 1) {
+		assert.Equal(t, 2, diff.Questions[0].Position)
+		assert.Equal(t, valueChange{2, 1}, diff.Questions[0].Fields["section"])
+	}
+}
+
+func TestDiffVersionsComparesShuffling(t *testing.T) {
+	from := &versionView{
+		Version:  1,
+		Sections: []models.Section{{Title: "Section", Order: 1}},
+		Questions: []models.Question{{
+			Text:    "Pick one",
+			Type:    "multipleChoice",
+			Order:   1,
+			Options: []models.Option{{Text: "Yes", Value: "yes"}, {Text: "Other", Value: "other"}},
+		}},
+	}
+	to := &versionView{
+		Version:  2,
+		Sections: []models.Section{{Title: "Section", Order: 1, ShuffleQuestions: true}},
+		Questions: []models.Question{{
+			Text:           "Pick one",
+			Type:           "multipleChoice",
+			Order:          1,
+			ShuffleOptions: true,
+			Options:        []models.Option{{Text: "Yes", Value: "yes"}, {Text: "Other", Value: "other", Pinned: true}},
+		}},
+	}
+
+	diff := diffVersions(from, to)
+	if assert.Len(t, diff.Sections, 1) {
+		assert.Equal(t, valueChange{false, true}, diff.Sections[0].Fields["shuffleQuestions"])
+	}
+	if assert.Len(t, diff.Questions, 1) {
+		assert.Equal(t, valueChange{false, true}, diff.Questions[0].Fields["shuffleOptions"])
+		assert.Equal(t, valueChange{
+			[]string{"Yes=yes", "Other=other"},
+			[]string{"Yes=yes", "Other=other (pinned)"},
+		}, diff.Questions[0].Fields["options"])
+	}
+}
+
+func TestDiffVersionsComparesMatrixRows(t *testing.T) {
+	matrix := func(rows ...models.MatrixRow) models.Question {
+		return models.Question{
+			Text:    "Rate each",
+			Type:    "matrix",
+			Order:   1,
+			Options: []models.Option{{Text: "Good", Value: "good"}, {Text: "Bad", Value: "bad"}},
+			Rows:    rows,
+		}
+	}
+	from := &versionView{Version: 1, Questions: []models.Question{matrix(models.MatrixRow{Text: "Speed", Value: "speed"})}}
+	to := &versionView{Version: 2, Questions: []models.Question{matrix(models.MatrixRow{Text: "Speed", Value: "speed"}, models.MatrixRow{Text: "Price", Value: "price"})}}
+
+	diff := diffVersions(from, to)
+	if assert.Len(t, diff.Questions, 1) {
+		assert.Equal(t, valueChange{
+			[]string{"Speed=speed"},
+			[]string{"Speed=speed", "Price=price"},
+		}, diff.Questions[0].Fields["rows"])
+	}
+}
+
+func TestVersionHandlers(t *testing.T) {
+	testDB := setupTestDB()
+	db.DB = testDB
+	defer func() {
+		sqlDB, _ := testDB.DB()
+		sqlDB.Close()
+	}()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/surveys", CreateSurvey).Methods("POST")
+	router.HandleFunc("/surveys/{id}", UpdateSurvey).Methods("PUT")
+	router.HandleFunc("/surveys/{id}/publish", PublishSurvey).Methods("POST")
+	router.HandleFunc("/surveys/{id}/responses", SubmitResponse).Methods("POST")
+	router.HandleFunc("/surveys/{id}/versions", ListSurveyVersions).Methods("GET")
+	router.HandleFunc("/surveys/{id}/versions/diff", DiffSurveyVersions).Methods("GET")
+	router.HandleFunc("/surveys/{id}/versions/{version:[0-9]+}", GetSurveyVersion).Methods("GET")
+
+	user := createTestUser(t, "versions")
+
+	surveyWithQuestion := func(text string) models.Survey {
+		return models.Survey{
+			Title:     "Test Survey for Versions",
+			Questions: []models.Question{{Text: text, Type: "text", Order: 1}},
+		}
+	}
+	liveQuestionID := func(t *testing.T, surveyID uint) uint {
+		var question models.Question
+		require.NoError(t, db.DB.Where("survey_id = ?", surveyID).First(&question).Error)
+		return question.ID
+	}
+	submit := func(surveyID, questionID uint) int {
+		body := map[string]interface{}{
+			"answers": []map[string]interface{}{{"questionId": questionID, "value": "an answer"}},
+		}
+		return serveAs(router, "POST", fmt.Sprintf("/surveys/%d/responses", surveyID), body, 0).Code
+	}
+
+	rr := serveAs(router, "POST", "/surveys", surveyWithQuestion("How was it?"), user.ID)
+	require.Equal(t, http.StatusCreated, rr.Code)
+	var survey models.Survey
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &survey))
+	require.Equal(t, http.StatusOK, serveAs(router, "POST", fmt.Sprintf("/surveys/%d/publish", survey.ID), nil, user.ID).Code)
+	firstQuestionID := liveQuestionID(t, survey.ID)
+
+	// Test that editing a published survey freezes the old revision and
+	// starts a new version
+	t.Run("EditCreatesVersion", func(t *testing.T) {
+		rr := serveAs(router, "PUT", fmt.Sprintf("/surveys/%d", survey.ID), surveyWithQuestion("How was your stay?"), user.ID)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = serveAs(router, "GET", fmt.Sprintf("/surveys/%d/versions", survey.ID), nil, user.ID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var versions []versionView
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &versions))
+		if assert.Len(t, versions, 2) {
+			assert.Equal(t, 1, versions[0].Version)
+			assert.Equal(t, 2, versions[1].Version)
+		}
+	})
+
+	// Test that each version keeps its own questions
+	t.Run("GetSurveyVersion", func(t *testing.T) {
+		for version, text := range map[int]string{1: "How was it?", 2: "How was your stay?"} {
+			rr := serveAs(router, "GET", fmt.Sprintf("/surveys/%d/versions/%d", survey.ID, version), nil, user.ID)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			var view versionView
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &view))
+			if assert.Len(t, view.Questions, 1) {
+				assert.Equal(t, text, view.Questions[0].Text)
+			}
+		}
+
+		rr := serveAs(router, "GET", fmt.Sprintf("/surveys/%d/versions/9", survey.ID), nil, user.ID)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		other := createTestUser(t, "other")
+		rr = serveAs(router, "GET", fmt.Sprintf("/surveys/%d/versions/1", survey.ID), nil, other.ID)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	// Test DiffSurveyVersions
+	t.Run("DiffSurveyVersions", func(t *testing.T) {
+		rr := serveAs(router, "GET", fmt.Sprintf("/surveys/%d/versions/diff?from=1&to=2", survey.ID), nil, user.ID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var diff versionDiff
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &diff))
+		if assert.Len(t, diff.Questions, 1) {
+			assert.Equal(t, "modified", diff.Questions[0].Change)
+			assert.Equal(t, valueChange{"How was it?", "How was your stay?"}, diff.Questions[0].Fields["text"])
+		}
+
+		rr = serveAs(router, "GET", fmt.Sprintf("/surveys/%d/versions/diff?from=1", survey.ID), nil, user.ID)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	// Test that responses are pinned to the version they answered
+	t.Run("ResponsePinnedToVersion", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnprocessableEntity, submit(survey.ID, firstQuestionID))
+
+		assert.Equal(t, http.StatusCreated, submit(survey.ID, liveQuestionID(t, survey.ID)))
+		var response models.Response
+		require.NoError(t, db.DB.Where("survey_id = ?", survey.ID).Last(&response).Error)
+		assert.Equal(t, 2, response.Version)
+	})
+
+	// Test that a survey edited while a response is being submitted answers
+	// 409 instead of storing answers against the wrong version
+	t.Run("SurveyChangedDuringSubmit", func(t *testing.T) {
+		// Bump the version just before the submission locks the survey row,
+		// as a concurrent edit would.
+		edited := false
+		require.NoError(t, testDB.Callback().Query().Before("gorm:query").Register("test:edit_survey", func(tx *gorm.DB) {
+			if _, locking := tx.Statement.Clauses["FOR"]; locking && !edited && tx.Statement.Table == "surveys" {
+				edited = true
+				testDB.Session(&gorm.Session{NewDB: true}).Exec("UPDATE surveys SET version = version + 1 WHERE id = ?", survey.ID)
+			}
+		}))
+		defer testDB.Callback().Query().Remove("test:edit_survey")
+
+		assert.Equal(t, http.StatusConflict, submit(survey.ID, liveQuestionID(t, survey.ID)))
+		assert.True(t, edited)
+	})
+}
@@ -1,15 +1,19 @@
 package handlers
 
 import (
-	"bytes"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/nikhilsahni7/SurveyX/authz"
 	"github.com/nikhilsahni7/SurveyX/db"
 	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/nikhilsahni7/SurveyX/validation"
+	"github.com/nikhilsahni7/SurveyX/webhooks"
+	"gorm.io/gorm"
 )
 
 func CreateWebhook(w http.ResponseWriter, r *http.Request) {
@@ -23,6 +27,27 @@ func CreateWebhook(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(uint)
 	webhook.UserID = userID
 
+	if webhook.Events, err = webhooks.NormalizeEvents(webhook.Events); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := webhooks.DefaultPolicy().CheckURL(r.Context(), webhook.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := authz.CheckSurvey(db.DB, userID, webhook.SurveyID, authz.ActionManageWebhooks); err != nil {
+		http.Error(w, "Survey not found", http.StatusNotFound)
+		return
+	}
+
+	if webhook.Secret == "" {
+		if webhook.Secret, err = webhooks.NewSecret(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	if err := db.DB.Create(&webhook).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -36,7 +61,7 @@ func ListWebhooks(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(uint)
 	var webhooks []models.Webhook
 
-	if err := db.DB.Where("user_id = ?", userID).Find(&webhooks).Error; err != nil {
+	if err := db.DB.Scopes(authz.Webhooks(userID)).Find(&webhooks).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -44,6 +69,14 @@ func ListWebhooks(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(webhooks)
 }
 
+// ListWebhookEvents returns the events webhooks can subscribe to.
+func ListWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version": webhooks.PayloadVersion,
+		"events":  webhooks.Catalog,
+	})
+}
+
 func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
@@ -59,15 +92,32 @@ func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID := r.Context().Value("userID").(uint)
 	var webhook models.Webhook
-	if err := db.DB.First(&webhook, id).Error; err != nil {
+	if err := authz.Webhook(db.DB, userID, uint(id), &webhook); err != nil {
 		http.Error(w, "Webhook not found", http.StatusNotFound)
 		return
 	}
 
+	events, err := webhooks.NormalizeEvents(updatedWebhook.Events)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := webhooks.DefaultPolicy().CheckURL(r.Context(), updatedWebhook.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	webhook.URL = updatedWebhook.URL
-	webhook.Events = updatedWebhook.Events
-	webhook.Secret = updatedWebhook.Secret
+	webhook.Events = events
+	// Secrets are changed through RotateWebhookSecret; an explicit secret
+	// replaces the old one without a grace period.
+	if updatedWebhook.Secret != "" {
+		webhook.Secret = updatedWebhook.Secret
+		webhook.PreviousSecret = ""
+		webhook.PreviousSecretExpiresAt = nil
+	}
 
 	if err := db.DB.Save(&webhook).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -85,7 +135,14 @@ func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := db.DB.Delete(&models.Webhook{}, id).Error; err != nil {
+	userID := r.Context().Value("userID").(uint)
+	var webhook models.Webhook
+	if err := authz.Webhook(db.DB, userID, uint(id), &webhook); err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	if err := db.DB.Delete(&webhook).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -93,33 +150,367 @@ func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func TriggerWebhook(surveyID uint, responseID uint) {
-	var webhooks []models.Webhook
-	db.DB.Where("survey_id = ?", surveyID).Find(&webhooks)
-
-	for _, webhook := range webhooks {
-		go func(hook models.Webhook) {
-			payload := map[string]interface{}{
-				"event":       "response_submitted",
-				"survey_id":   surveyID,
-				"response_id": responseID,
-			}
-			jsonPayload, _ := json.Marshal(payload)
-
-			req, _ := http.NewRequest("POST", hook.URL, bytes.NewBuffer(jsonPayload))
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("X-Webhook-Secret", hook.Secret)
-
-			client := &http.Client{}
-			resp, err := client.Do(req)
-			if err != nil {
-				// Log the error
-				log.Printf("Error triggering webhook: %v", err)
-			} else {
-				defer resp.Body.Close()
-				// Log the response status
-				log.Printf("Webhook triggered. Status: %s", resp.Status)
-			}
-		}(webhook)
+// RotateWebhookSecret generates a new signing secret. Requests are signed with
+// both the new and the old secret for gracePeriodHours (24 by default, at most
+// a week) so receivers can update without dropping events.
+func RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	input := struct {
+		GracePeriodHours *int `json:"gracePeriodHours"`
+	}{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	grace := 24
+	if input.GracePeriodHours != nil {
+		grace = *input.GracePeriodHours
+	}
+	if grace < 0 || grace > 7*24 {
+		http.Error(w, "gracePeriodHours must be between 0 and 168", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	var webhook models.Webhook
+	if err := authz.Webhook(db.DB, userID, uint(id), &webhook); err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
 	}
+
+	if err := webhooks.Rotate(&webhook, time.Duration(grace)*time.Hour); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.DB.Save(&webhook).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"secret":                  webhook.Secret,
+		"previousSecretExpiresAt": webhook.PreviousSecretExpiresAt,
+	})
+}
+
+// publishSurveyEvent queues a survey event carrying the survey with its
+// questions.
+func publishSurveyEvent(tx *gorm.DB, surveyID uint, event webhooks.Event) error {
+	data, err := surveyEventData(tx, surveyID)
+	if err != nil {
+		return err
+	}
+	return webhooks.Publish(tx, surveyID, event, data)
+}
+
+// publishSurveyClosed queues survey.closed unless it was queued before. The
+// survey's ClosedEventAt is claimed with a conditional update, so submissions
+// filling the response limit and the sweeper never queue it twice.
+func publishSurveyClosed(tx *gorm.DB, surveyID uint, now time.Time) error {
+	result := tx.Model(&models.Survey{}).Where("id = ? AND closed_event_at IS NULL", surveyID).UpdateColumn("closed_event_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	return publishSurveyEvent(tx, surveyID, webhooks.EventSurveyClosed)
+}
+
+// publishResponseEvent queues a response event carrying the response with its
+// answers.
+func publishResponseEvent(tx *gorm.DB, response *models.Response, event webhooks.Event) error {
+	return webhooks.Publish(tx, response.SurveyID, event, responseEventData(response))
+}
+
+// publishMemberAdded queues team.member_added for the webhooks of the team's
+// surveys.
+func publishMemberAdded(tx *gorm.DB, member *models.TeamMember) error {
+	var user models.User
+	if err := tx.Select("id", "name", "email").First(&user, member.UserID).Error; err != nil {
+		return err
+	}
+	return webhooks.PublishTeam(tx, member.TeamID, webhooks.EventTeamMemberAdded, memberAddedData(member, &user))
+}
+
+func surveyEventData(tx *gorm.DB, surveyID uint) (interface{}, error) {
+	var survey models.Survey
+	if err := tx.Preload("Sections.Rules").Preload("Questions.Options").Preload("Questions.Rows").Preload("Questions.Conditions").First(&survey, surveyID).Error; err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"survey": survey}, nil
+}
+
+func responseEventData(response *models.Response) interface{} {
+	return map[string]interface{}{"response": response}
+}
+
+func memberAddedData(member *models.TeamMember, user *models.User) interface{} {
+	return map[string]interface{}{
+		"teamId": member.TeamID,
+		"role":   member.Role,
+		"user": map[string]interface{}{
+			"id":    user.ID,
+			"name":  user.Name,
+			"email": user.Email,
+		},
+	}
+}
+
+func exportCompletedData(surveyID uint, responses int, exportedBy uint) interface{} {
+	return map[string]interface{}{
+		"surveyId":   surveyID,
+		"format":     "csv",
+		"responses":  responses,
+		"exportedBy": exportedBy,
+	}
+}
+
+// sampleEventData builds the data event would carry for the webhook's survey.
+// Response events use the latest response, or made up answers when the survey
+// has none yet; team events use the current user as the new member.
+func sampleEventData(tx *gorm.DB, webhook *models.Webhook, event webhooks.Event, userID uint) (interface{}, error) {
+	switch event {
+	case webhooks.EventResponseSubmitted, webhooks.EventResponseDeleted:
+		var response models.Response
+		err := tx.Where("survey_id = ? AND status = ?", webhook.SurveyID, responseCompleted).Preload("Answers").Order("created_at DESC").First(&response).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return sampleResponseData(tx, webhook.SurveyID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return responseEventData(&response), nil
+
+	case webhooks.EventTeamMemberAdded:
+		var survey models.Survey
+		if err := tx.Select("id", "team_id").First(&survey, webhook.SurveyID).Error; err != nil {
+			return nil, err
+		}
+		var user models.User
+		if err := tx.Select("id", "name", "email").First(&user, userID).Error; err != nil {
+			return nil, err
+		}
+		member := models.TeamMember{UserID: user.ID, Role: authz.RoleViewer}
+		if survey.TeamID != nil {
+			member.TeamID = *survey.TeamID
+		}
+		return memberAddedData(&member, &user), nil
+
+	case webhooks.EventExportCompleted:
+		var count int64
+		if err := tx.Model(&models.Response{}).Where("survey_id = ? AND status = ?", webhook.SurveyID, responseCompleted).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		return exportCompletedData(webhook.SurveyID, int(count), userID), nil
+	}
+
+	return surveyEventData(tx, webhook.SurveyID)
+}
+
+func sampleResponseData(tx *gorm.DB, surveyID uint) (interface{}, error) {
+	var survey models.Survey
+	if err := tx.Preload("Questions.Options").Preload("Questions.Rows").First(&survey, surveyID).Error; err != nil {
+		return nil, err
+	}
+	sortQuestions(survey.Questions)
+
+	response := models.Response{SurveyID: survey.ID, Version: survey.Version}
+	response.CreatedAt = time.Now()
+	for _, q := range survey.Questions {
+		response.Answers = append(response.Answers, models.Answer{QuestionID: q.ID, Value: sampleAnswer(q)})
+	}
+	return responseEventData(&response), nil
+}
+
+func sampleAnswer(q models.Question) string {
+	if len(q.Options) > 0 {
+		return validation.OptionValue(q.Options[0])
+	}
+	switch q.Type {
+	case "rating", "scale":
+		if q.MaxValue != nil {
+			return strconv.Itoa(*q.MaxValue)
+		}
+		return "5"
+	}
+	return "Sample answer"
+}
+
+// PreviewWebhookEvent renders the body that would be sent to the webhook for
+// the event query parameter, using the webhook's survey.
+func PreviewWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	webhook, event, ok := loadWebhookEvent(w, r, r.URL.Query().Get("event"))
+	if !ok {
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	data, err := sampleEventData(db.DB, webhook, event, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	payload, err := webhooks.Encode(event, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+// TestWebhook sends a signed sample event to the webhook right away and
+// reports how the receiver answered. The request does not go through the
+// delivery queue and is not retried.
+func TestWebhook(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Event string `json:"event"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if input.Event == "" {
+		input.Event = string(webhooks.EventResponseSubmitted)
+	}
+
+	webhook, event, ok := loadWebhookEvent(w, r, input.Event)
+	if !ok {
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	data, err := sampleEventData(db.DB, webhook, event, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	payload, err := webhooks.Encode(event, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := webhooks.Send(r.Context(), webhooks.NewClient(), *webhook, string(event), "test", payload)
+
+	output := map[string]interface{}{
+		"event":      event,
+		"success":    result.Err == nil && result.StatusCode >= 200 && result.StatusCode < 300,
+		"statusCode": result.StatusCode,
+		"headers":    result.Header,
+		"body":       result.Body,
+		"latencyMs":  result.Latency.Milliseconds(),
+	}
+	if result.Err != nil {
+		output["error"] = result.Err.Error()
+	}
+	json.NewEncoder(w).Encode(output)
+}
+
+func loadWebhookEvent(w http.ResponseWriter, r *http.Request, name string) (*models.Webhook, webhooks.Event, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	event, ok := webhooks.ParseEvent(name)
+	if !ok {
+		http.Error(w, "Unknown event", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	var webhook models.Webhook
+	if err := authz.Webhook(db.DB, userID, uint(id), &webhook); err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return nil, "", false
+	}
+	return &webhook, event, true
+}
+
+func ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	var webhook models.Webhook
+	if err := authz.Webhook(db.DB, userID, uint(id), &webhook); err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	limit := 50
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 200 {
+		limit = n
+	}
+
+	query := db.DB.Where("webhook_id = ?", webhook.ID).Preload("AttemptLog", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("created_at")
+	})
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("created_at DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// RedeliverWebhookDelivery queues the payload of an earlier delivery again as
+// a new delivery, leaving the original and its attempts untouched.
+func RedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	deliveryID, err := strconv.ParseUint(vars["deliveryId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+	var webhook models.Webhook
+	if err := authz.Webhook(db.DB, userID, uint(id), &webhook); err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	var original models.WebhookDelivery
+	if err := db.DB.Where("webhook_id = ?", webhook.ID).First(&original, deliveryID).Error; err != nil {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+
+	delivery, err := webhooks.Enqueue(db.DB, webhook, original.Event, []byte(original.Payload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
 }
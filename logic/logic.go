@@ -0,0 +1,264 @@
+// Package logic evaluates the conditional display rules attached to survey
+// questions.
+//
+// Every models.Condition on a question is a single clause comparing the answer
+// of another question against a value. Clauses that share the same Group are
+// combined with AND, and the groups of a question are combined with OR. A
+// question without conditions is always visible.
+package logic
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+)
+
+const (
+	OpEquals      = "equals"
+	OpNotEquals   = "not equals"
+	OpGreaterThan = "greater than"
+	OpLessThan    = "less than"
+	OpContains    = "contains"
+	OpIn          = "in"
+	OpIsEmpty     = "is empty"
+	OpIsNotEmpty  = "is not empty"
+)
+
+var operators = map[string]bool{
+	OpEquals:      true,
+	OpNotEquals:   true,
+	OpGreaterThan: true,
+	OpLessThan:    true,
+	OpContains:    true,
+	OpIn:          true,
+	OpIsEmpty:     true,
+	OpIsNotEmpty:  true,
+}
+
+// ValidOperator reports whether op is understood by the engine.
+func ValidOperator(op string) bool {
+	return operators[op]
+}
+
+// Clause is the public representation of a single condition.
+type Clause struct {
+	QuestionID uint   `json:"questionId"`
+	Operator   string `json:"operator"`
+	Value      string `json:"value,omitempty"`
+}
+
+// Group is a set of clauses that must all hold.
+type Group struct {
+	All []Clause `json:"all"`
+}
+
+// Rule describes when a question is shown: at least one group must hold.
+type Rule struct {
+	QuestionID uint    `json:"questionId"`
+	Any        []Group `json:"any"`
+}
+
+// Rules converts the conditions of questions into the stable form exposed to
+// clients. Questions without conditions are omitted.
+func Rules(questions []models.Question) []Rule {
+	rules := make([]Rule, 0)
+	for _, q := range questions {
+		groups := groupConditions(q.Conditions)
+		if len(groups) == 0 {
+			continue
+		}
+		rule := Rule{QuestionID: q.ID}
+		for _, g := range groups {
+			group := Group{All: make([]Clause, 0, len(g))}
+			for _, c := range g {
+				group.All = append(group.All, Clause{
+					QuestionID: c.DependentOnID,
+					Operator:   c.Operator,
+					Value:      c.DependentOnValue,
+				})
+			}
+			rule.Any = append(rule.Any, group)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Visible returns the visibility of every question given a (possibly partial)
+// set of answers keyed by question ID. Answers to hidden questions are ignored
+// when evaluating the questions that depend on them, and a dependency that
+// closes a cycle is treated as unanswered.
+func Visible(questions []models.Question, answers map[uint]string) map[uint]bool {
+	e := evaluator{
+		questions: make(map[uint]*models.Question, len(questions)),
+		answers:   answers,
+		visible:   make(map[uint]bool, len(questions)),
+		visiting:  make(map[uint]bool),
+	}
+	for i := range questions {
+		e.questions[questions[i].ID] = &questions[i]
+	}
+	for _, q := range questions {
+		e.isVisible(q.ID)
+	}
+	return e.visible
+}
+
+type evaluator struct {
+	questions map[uint]*models.Question
+	answers   map[uint]string
+	visible   map[uint]bool
+	visiting  map[uint]bool
+}
+
+func (e *evaluator) isVisible(id uint) bool {
+	if v, ok := e.visible[id]; ok {
+		return v
+	}
+	q, ok := e.questions[id]
+	if !ok || e.visiting[id] {
+		return false
+	}
+
+	e.visiting[id] = true
+	groups := groupConditions(q.Conditions)
+	result := len(groups) == 0
+	for _, g := range groups {
+		if e.groupHolds(g) {
+			result = true
+			break
+		}
+	}
+	delete(e.visiting, id)
+
+	e.visible[id] = result
+	return result
+}
+
+func (e *evaluator) groupHolds(conditions []models.Condition) bool {
+	for _, c := range conditions {
+		answer, answered := "", false
+		if e.isVisible(c.DependentOnID) {
+			answer, answered = e.answers[c.DependentOnID]
+			if answered && IsEmptyAnswer(e.questions[c.DependentOnID].Type, answer) {
+				answered = false
+			}
+		}
+		if !Evaluate(c.Operator, answer, answered, c.DependentOnValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// Evaluate applies a single operator to an answer. answered is false when the
+// dependent question has no (visible) answer at all.
+func Evaluate(operator, answer string, answered bool, expected string) bool {
+	empty := !answered || IsEmpty(answer)
+
+	switch operator {
+	case OpIsEmpty:
+		return empty
+	case OpIsNotEmpty:
+		return !empty
+	}
+	if empty {
+		return operator == OpNotEquals
+	}
+
+	switch operator {
+	case OpEquals:
+		return strings.TrimSpace(answer) == strings.TrimSpace(expected)
+	case OpNotEquals:
+		return strings.TrimSpace(answer) != strings.TrimSpace(expected)
+	case OpGreaterThan, OpLessThan:
+		a, errA := strconv.ParseFloat(strings.TrimSpace(answer), 64)
+		b, errB := strconv.ParseFloat(strings.TrimSpace(expected), 64)
+		if errA != nil || errB != nil {
+			return false
+		}
+		if operator == OpGreaterThan {
+			return a > b
+		}
+		return a < b
+	case OpContains:
+		if values, ok := MultiValues(answer); ok {
+			for _, v := range values {
+				if v == expected {
+					return true
+				}
+			}
+			return false
+		}
+		return strings.Contains(answer, expected)
+	case OpIn:
+		for _, v := range strings.Split(expected, ",") {
+			if strings.TrimSpace(v) == strings.TrimSpace(answer) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// groupConditions splits conditions by Group, ordered by group number.
+func groupConditions(conditions []models.Condition) [][]models.Condition {
+	if len(conditions) == 0 {
+		return nil
+	}
+	byGroup := make(map[int][]models.Condition)
+	keys := make([]int, 0)
+	for _, c := range conditions {
+		if _, ok := byGroup[c.Group]; !ok {
+			keys = append(keys, c.Group)
+		}
+		byGroup[c.Group] = append(byGroup[c.Group], c)
+	}
+	sort.Ints(keys)
+
+	groups := make([][]models.Condition, 0, len(keys))
+	for _, k := range keys {
+		groups = append(groups, byGroup[k])
+	}
+	return groups
+}
+
+// IsEmpty reports whether an answer carries no value: blank text or an empty
+// multi-select or ranking.
+func IsEmpty(answer string) bool {
+	trimmed := strings.TrimSpace(answer)
+	if trimmed == "" {
+		return true
+	}
+	if values, ok := MultiValues(trimmed); ok {
+		return len(values) == 0
+	}
+	return false
+}
+
+// IsEmptyAnswer is IsEmpty for an answer to a question of the given type. A
+// matrix answer without rows, "{}", is empty too; for other types it is an
+// ordinary value.
+func IsEmptyAnswer(questionType, answer string) bool {
+	if questionType == "matrix" && strings.TrimSpace(answer) == "{}" {
+		return true
+	}
+	return IsEmpty(answer)
+}
+
+// MultiValues decodes answers to multi-select questions, which are stored as
+// a JSON array of strings. ok is false when answer is a plain scalar value.
+func MultiValues(answer string) (values []string, ok bool) {
+	trimmed := strings.TrimSpace(answer)
+	if !strings.HasPrefix(trimmed, "[") {
+		return nil, false
+	}
+	if err := json.Unmarshal([]byte(trimmed), &values); err != nil {
+		return nil, false
+	}
+	return values, true
+}
@@ -0,0 +1,114 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func question(id uint, conditions ...models.Condition) models.Question {
+	return models.Question{Model: gorm.Model{ID: id}, Conditions: conditions}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator string
+		answer   string
+		answered bool
+		expected string
+		want     bool
+	}{
+		{"equals", OpEquals, "yes", true, "yes", true},
+		{"equals trims", OpEquals, " yes ", true, "yes", true},
+		{"equals mismatch", OpEquals, "no", true, "yes", false},
+		{"not equals", OpNotEquals, "no", true, "yes", true},
+		{"not equals unanswered", OpNotEquals, "", false, "yes", true},
+		{"greater than", OpGreaterThan, "7", true, "5", true},
+		{"greater than non numeric", OpGreaterThan, "seven", true, "5", false},
+		{"less than", OpLessThan, "3", true, "5", true},
+		{"contains substring", OpContains, "I like red", true, "red", true},
+		{"contains multi select", OpContains, `["red","blue"]`, true, "blue", true},
+		{"contains multi select miss", OpContains, `["red","blue"]`, true, "re", false},
+		{"in list", OpIn, "b", true, "a, b, c", true},
+		{"in list miss", OpIn, "d", true, "a,b,c", false},
+		{"is empty unanswered", OpIsEmpty, "", false, "", true},
+		{"is empty blank", OpIsEmpty, "  ", true, "", true},
+		{"is empty empty array", OpIsEmpty, "[]", true, "", true},
+		{"is not empty", OpIsNotEmpty, "x", true, "", true},
+		{"unknown operator", "matches", "x", true, "x", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Evaluate(tt.operator, tt.answer, tt.answered, tt.expected))
+		})
+	}
+}
+
+func TestIsEmptyAnswer(t *testing.T) {
+	assert.True(t, IsEmptyAnswer("matrix", " {} "))
+	assert.True(t, IsEmptyAnswer("matrix", ""))
+	assert.False(t, IsEmptyAnswer("matrix", `{"a":"yes"}`))
+	// Only matrix answers are objects; elsewhere "{}" is a literal answer.
+	assert.False(t, IsEmptyAnswer("text", "{}"))
+	assert.True(t, IsEmptyAnswer("text", "  "))
+}
+
+func TestVisible(t *testing.T) {
+	questions := []models.Question{
+		question(1),
+		question(2, models.Condition{DependentOnID: 1, Operator: OpEquals, DependentOnValue: "yes"}),
+		// Shown when q1 is "maybe", or when q1 is "yes" AND q2 > 3.
+		question(3,
+			models.Condition{DependentOnID: 1, Operator: OpEquals, DependentOnValue: "maybe", Group: 0},
+			models.Condition{DependentOnID: 1, Operator: OpEquals, DependentOnValue: "yes", Group: 1},
+			models.Condition{DependentOnID: 2, Operator: OpGreaterThan, DependentOnValue: "3", Group: 1},
+		),
+	}
+
+	visible := Visible(questions, map[uint]string{1: "yes", 2: "5"})
+	assert.True(t, visible[1])
+	assert.True(t, visible[2])
+	assert.True(t, visible[3])
+
+	visible = Visible(questions, map[uint]string{1: "maybe"})
+	assert.False(t, visible[2])
+	assert.True(t, visible[3])
+
+	// The answer to q2 is ignored once q2 is hidden.
+	visible = Visible(questions, map[uint]string{1: "no", 2: "5"})
+	assert.False(t, visible[2])
+	assert.False(t, visible[3])
+}
+
+func TestVisibleCycle(t *testing.T) {
+	questions := []models.Question{
+		question(1, models.Condition{DependentOnID: 2, Operator: OpIsEmpty}),
+		question(2, models.Condition{DependentOnID: 1, Operator: OpIsEmpty}),
+	}
+
+	visible := Visible(questions, map[uint]string{})
+	assert.Len(t, visible, 2)
+}
+
+func TestRules(t *testing.T) {
+	questions := []models.Question{
+		question(1),
+		question(2,
+			models.Condition{DependentOnID: 1, Operator: OpEquals, DependentOnValue: "a", Group: 1},
+			models.Condition{DependentOnID: 1, Operator: OpIsEmpty, Group: 0},
+		),
+	}
+
+	rules := Rules(questions)
+	assert.Equal(t, []Rule{{
+		QuestionID: 2,
+		Any: []Group{
+			{All: []Clause{{QuestionID: 1, Operator: OpIsEmpty}}},
+			{All: []Clause{{QuestionID: 1, Operator: OpEquals, Value: "a"}}},
+		},
+	}}, rules)
+}
@@ -0,0 +1,169 @@
+package logic
+
+import (
+	"sort"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+)
+
+// Page is one page of a survey as shown to respondents. Surveys without
+// sections have a single page with SectionID 0.
+type Page struct {
+	SectionID   uint              `json:"sectionId"`
+	Title       string            `json:"title,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Questions   []models.Question `json:"questions"`
+	Jumps       []Jump            `json:"jumps"`
+
+	shuffle bool
+}
+
+// Jump is a page rule in the form exposed to clients: after the page, go to
+// GoToSectionID if the clause holds, or end the survey if it is nil.
+type Jump struct {
+	Clause
+	GoToSectionID *uint `json:"goToSectionId"`
+}
+
+// Pages groups questions into the pages of their sections, in section Order
+// and question Order. Questions that belong to no known section go on the
+// first page.
+func Pages(sections []models.Section, questions []models.Question) []Page {
+	sorted := make([]models.Section, len(sections))
+	copy(sorted, sections)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Order < sorted[j].Order })
+
+	pages := make([]Page, 0, len(sorted))
+	index := make(map[uint]int, len(sorted))
+	for _, s := range sorted {
+		rules := make([]models.PageRule, len(s.Rules))
+		copy(rules, s.Rules)
+		sort.SliceStable(rules, func(i, j int) bool { return rules[i].Order < rules[j].Order })
+
+		page := Page{
+			SectionID:   s.ID,
+			Title:       s.Title,
+			Description: s.Description,
+			Questions:   make([]models.Question, 0),
+			Jumps:       make([]Jump, 0, len(rules)),
+			shuffle:     s.ShuffleQuestions,
+		}
+		for _, r := range rules {
+			page.Jumps = append(page.Jumps, Jump{
+				Clause:        Clause{QuestionID: r.QuestionID, Operator: r.Operator, Value: r.Value},
+				GoToSectionID: r.GoToSectionID,
+			})
+		}
+		index[s.ID] = len(pages)
+		pages = append(pages, page)
+	}
+	if len(pages) == 0 {
+		pages = append(pages, Page{Questions: make([]models.Question, 0), Jumps: make([]Jump, 0)})
+	}
+
+	for _, q := range questions {
+		i := 0
+		if q.SectionID != nil {
+			if found, ok := index[*q.SectionID]; ok {
+				i = found
+			}
+		}
+		pages[i].Questions = append(pages[i].Questions, q)
+	}
+	for i := range pages {
+		sort.SliceStable(pages[i].Questions, func(a, b int) bool {
+			return pages[i].Questions[a].Order < pages[i].Questions[b].Order
+		})
+	}
+	return pages
+}
+
+// Path returns the indexes of the pages a respondent goes through given a
+// (possibly partial) set of answers. After each page its jumps are tried in
+// order, looking only at answers on the pages visited so far; without a
+// matching jump the next page follows. A jump back to a visited page ends the
+// path.
+func Path(pages []Page, answers map[uint]string) []int {
+	index := make(map[uint]int, len(pages))
+	var questions []models.Question
+	for i, p := range pages {
+		index[p.SectionID] = i
+		questions = append(questions, p.Questions...)
+	}
+
+	path := make([]int, 0, len(pages))
+	seen := make(map[int]bool, len(pages))
+	reached := make(map[uint]string, len(answers))
+	for i := 0; i < len(pages) && !seen[i]; {
+		seen[i] = true
+		path = append(path, i)
+		for _, q := range pages[i].Questions {
+			if answer, ok := answers[q.ID]; ok {
+				reached[q.ID] = answer
+			}
+		}
+
+		next := i + 1
+		if len(pages[i].Jumps) > 0 {
+			visible := Visible(questions, reached)
+			for _, j := range pages[i].Jumps {
+				answer, answered := "", false
+				if visible[j.QuestionID] {
+					answer, answered = reached[j.QuestionID]
+				}
+				if !Evaluate(j.Operator, answer, answered, j.Value) {
+					continue
+				}
+				if j.GoToSectionID == nil {
+					next = len(pages)
+				} else if target, ok := index[*j.GoToSectionID]; ok {
+					next = target
+				}
+				break
+			}
+		}
+		i = next
+	}
+	return path
+}
+
+// VisibleOnPath is Visible for surveys with pages: questions on pages the
+// respondent skips are hidden too, and their answers are ignored.
+func VisibleOnPath(pages []Page, answers map[uint]string) map[uint]bool {
+	var questions []models.Question
+	for _, p := range pages {
+		questions = append(questions, p.Questions...)
+	}
+
+	onPath := make(map[uint]bool, len(questions))
+	for _, i := range Path(pages, answers) {
+		for _, q := range pages[i].Questions {
+			onPath[q.ID] = true
+		}
+	}
+
+	reached := make(map[uint]string, len(answers))
+	for id, answer := range answers {
+		if onPath[id] {
+			reached[id] = answer
+		}
+	}
+
+	visible := Visible(questions, reached)
+	for id := range visible {
+		visible[id] = visible[id] && onPath[id]
+	}
+	return visible
+}
+
+// NextPage returns the index of the page that follows page current, or false
+// if the survey ends after it or current is not on the respondent's path.
+func NextPage(pages []Page, answers map[uint]string, current int) (int, bool) {
+	path := Path(pages, answers)
+	for i, p := range path {
+		if p == current && i+1 < len(path) {
+			return path[i+1], true
+		}
+	}
+	return 0, false
+}
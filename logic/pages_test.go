@@ -0,0 +1,89 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func uintPtr(n uint) *uint {
+	return &n
+}
+
+func inSection(q models.Question, sectionID uint, order int) models.Question {
+	q.SectionID = uintPtr(sectionID)
+	q.Order = order
+	return q
+}
+
+// pagedSurvey has four pages. After page 10, answering "skip" to question 1
+// jumps to page 40 and answering "stop" ends the survey.
+func pagedSurvey() ([]models.Section, []models.Question) {
+	sections := []models.Section{
+		{Model: gorm.Model{ID: 30}, Order: 3},
+		{Model: gorm.Model{ID: 10}, Order: 1, Rules: []models.PageRule{
+			{Order: 2, QuestionID: 1, Operator: OpEquals, Value: "stop", GoToSectionID: nil},
+			{Order: 1, QuestionID: 1, Operator: OpEquals, Value: "skip", GoToSectionID: uintPtr(40)},
+		}},
+		{Model: gorm.Model{ID: 20}, Order: 2},
+		{Model: gorm.Model{ID: 40}, Order: 4},
+	}
+	questions := []models.Question{
+		inSection(question(4), 40, 1),
+		inSection(question(2), 10, 2),
+		inSection(question(1), 10, 1),
+		inSection(question(3, models.Condition{DependentOnID: 2, Operator: OpIsNotEmpty}), 30, 1),
+		inSection(question(5), 20, 1),
+	}
+	return sections, questions
+}
+
+func TestPages(t *testing.T) {
+	sections, questions := pagedSurvey()
+	pages := Pages(sections, questions)
+
+	var order []uint
+	for _, p := range pages {
+		order = append(order, p.SectionID)
+	}
+	assert.Equal(t, []uint{10, 20, 30, 40}, order)
+	assert.Equal(t, uint(1), pages[0].Questions[0].ID)
+	assert.Equal(t, uint(2), pages[0].Questions[1].ID)
+	assert.Equal(t, "skip", pages[0].Jumps[0].Value)
+
+	flat := Pages(nil, []models.Question{question(1), question(2)})
+	assert.Len(t, flat, 1)
+	assert.Equal(t, uint(0), flat[0].SectionID)
+	assert.Len(t, flat[0].Questions, 2)
+}
+
+func TestPath(t *testing.T) {
+	sections, questions := pagedSurvey()
+	pages := Pages(sections, questions)
+
+	assert.Equal(t, []int{0, 1, 2, 3}, Path(pages, map[uint]string{}))
+	assert.Equal(t, []int{0, 3}, Path(pages, map[uint]string{1: "skip"}))
+	assert.Equal(t, []int{0}, Path(pages, map[uint]string{1: "stop"}))
+
+	next, ok := NextPage(pages, map[uint]string{1: "skip"}, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 3, next)
+	_, ok = NextPage(pages, map[uint]string{1: "stop"}, 0)
+	assert.False(t, ok)
+	_, ok = NextPage(pages, map[uint]string{1: "skip"}, 1)
+	assert.False(t, ok, "page 20 is skipped")
+}
+
+func TestVisibleOnPath(t *testing.T) {
+	sections, questions := pagedSurvey()
+	pages := Pages(sections, questions)
+
+	visible := VisibleOnPath(pages, map[uint]string{1: "go", 2: "x"})
+	assert.Equal(t, map[uint]bool{1: true, 2: true, 3: true, 4: true, 5: true}, visible)
+
+	// Skipped pages are hidden along with questions that depend on them.
+	visible = VisibleOnPath(pages, map[uint]string{1: "skip", 2: "x", 5: "y"})
+	assert.Equal(t, map[uint]bool{1: true, 2: true, 3: false, 4: true, 5: false}, visible)
+}
@@ -0,0 +1,122 @@
+package logic
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+)
+
+// Order is the order a respondent was shown the questions in, across all
+// pages, and the options of questions with shuffled options.
+type Order struct {
+	Questions []uint          `json:"questions"`
+	Options   map[uint][]uint `json:"options,omitempty"`
+}
+
+// Shuffle returns the order for the respondent identified by seed. The same
+// seed always gives the same order. Every page and question is shuffled with
+// its own generator, so editing one of them leaves the order of the others
+// unchanged.
+func Shuffle(pages []Page, seed string) Order {
+	order := Order{Questions: make([]uint, 0), Options: make(map[uint][]uint)}
+	for _, p := range pages {
+		questions := make([]uint, 0, len(p.Questions))
+		for _, q := range p.Questions {
+			questions = append(questions, q.ID)
+		}
+		if p.shuffle {
+			shuffle(questions, nil, seed, "section", p.SectionID)
+		}
+		order.Questions = append(order.Questions, questions...)
+
+		for _, q := range p.Questions {
+			if !q.ShuffleOptions || len(q.Options) == 0 {
+				continue
+			}
+			options := sortedOptions(q.Options)
+			ids := make([]uint, len(options))
+			pinned := make([]bool, len(options))
+			for i, o := range options {
+				ids[i], pinned[i] = o.ID, o.Pinned
+			}
+			shuffle(ids, pinned, seed, "question", q.ID)
+			order.Options[q.ID] = ids
+		}
+	}
+	return order
+}
+
+// ApplyOrder returns copies of pages with questions and options arranged as
+// in order. Questions and options missing from order come after the others,
+// in their original order.
+func ApplyOrder(pages []Page, order Order) []Page {
+	position := make(map[uint]int, len(order.Questions))
+	for i, id := range order.Questions {
+		position[id] = i
+	}
+	rank := func(positions map[uint]int, id uint) int {
+		if p, ok := positions[id]; ok {
+			return p
+		}
+		return len(positions)
+	}
+
+	arranged := make([]Page, len(pages))
+	for i, p := range pages {
+		questions := make([]models.Question, len(p.Questions))
+		copy(questions, p.Questions)
+		sort.SliceStable(questions, func(a, b int) bool {
+			return rank(position, questions[a].ID) < rank(position, questions[b].ID)
+		})
+
+		for j := range questions {
+			ids, ok := order.Options[questions[j].ID]
+			if !ok {
+				continue
+			}
+			optionPosition := make(map[uint]int, len(ids))
+			for k, id := range ids {
+				optionPosition[id] = k
+			}
+			options := sortedOptions(questions[j].Options)
+			sort.SliceStable(options, func(a, b int) bool {
+				return rank(optionPosition, options[a].ID) < rank(optionPosition, options[b].ID)
+			})
+			questions[j].Options = options
+		}
+
+		p.Questions = questions
+		arranged[i] = p
+	}
+	return arranged
+}
+
+// shuffle permutes ids in place, leaving the entries marked in pinned at
+// their index. The generator is seeded from seed and the shuffled item.
+func shuffle(ids []uint, pinned []bool, seed, kind string, id uint) {
+	free := make([]int, 0, len(ids))
+	for i := range ids {
+		if pinned == nil || !pinned[i] {
+			free = append(free, i)
+		}
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(seed + "/" + kind + "/" + strconv.FormatUint(uint64(id), 10)))
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+	rng.Shuffle(len(free), func(a, b int) {
+		ids[free[a]], ids[free[b]] = ids[free[b]], ids[free[a]]
+	})
+}
+
+// sortedOptions returns a copy of options in the order they were created,
+// the order they are shown in without shuffling.
+func sortedOptions(options []models.Option) []models.Option {
+	sorted := make([]models.Option, len(options))
+	copy(sorted, options)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	return sorted
+}
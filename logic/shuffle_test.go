@@ -0,0 +1,88 @@
+package logic
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// shuffledSurvey has a shuffled first page of eight questions, the last of
+// which has shuffled options with "Other" pinned, and a fixed second page.
+func shuffledSurvey() []Page {
+	sections := []models.Section{
+		{Model: gorm.Model{ID: 1}, Order: 1, ShuffleQuestions: true},
+		{Model: gorm.Model{ID: 2}, Order: 2},
+	}
+	var questions []models.Question
+	for i := uint(1); i <= 8; i++ {
+		questions = append(questions, inSection(question(i), 1, int(i)))
+	}
+	for i := uint(1); i <= 6; i++ {
+		questions[7].Options = append(questions[7].Options, models.Option{Model: gorm.Model{ID: 100 + i}, Value: fmt.Sprint(i)})
+	}
+	questions[7].Options = append(questions[7].Options, models.Option{Model: gorm.Model{ID: 107}, Value: "other", Pinned: true})
+	questions[7].ShuffleOptions = true
+	questions = append(questions, inSection(question(9), 2, 1), inSection(question(10), 2, 2))
+	return Pages(sections, questions)
+}
+
+func TestShuffle(t *testing.T) {
+	pages := shuffledSurvey()
+
+	order := Shuffle(pages, "respondent-a")
+	assert.Equal(t, order, Shuffle(pages, "respondent-a"), "same seed gives the same order")
+	assert.ElementsMatch(t, []uint{1, 2, 3, 4, 5, 6, 7, 8}, order.Questions[:8])
+	assert.Equal(t, []uint{9, 10}, order.Questions[8:], "pages without shuffling keep their order")
+
+	require.Len(t, order.Options[8], 7)
+	assert.Equal(t, uint(107), order.Options[8][6], "pinned option stays in place")
+	assert.ElementsMatch(t, []uint{101, 102, 103, 104, 105, 106}, order.Options[8][:6])
+	assert.NotContains(t, order.Options, uint(9))
+
+	differs := false
+	for _, seed := range []string{"b", "c", "d", "e"} {
+		if fmt.Sprint(Shuffle(pages, seed)) != fmt.Sprint(order) {
+			differs = true
+		}
+	}
+	assert.True(t, differs, "other seeds give other orders")
+}
+
+func TestApplyOrder(t *testing.T) {
+	pages := shuffledSurvey()
+	order := Shuffle(pages, "respondent-a")
+
+	arranged := ApplyOrder(pages, order)
+	var questions []uint
+	var options []uint
+	for _, p := range arranged {
+		for _, q := range p.Questions {
+			questions = append(questions, q.ID)
+			if q.ID == 8 {
+				for _, o := range q.Options {
+					options = append(options, o.ID)
+				}
+			}
+		}
+	}
+	assert.Equal(t, order.Questions, questions)
+	assert.Equal(t, order.Options[8], options)
+	assert.Equal(t, uint(1), pages[0].Questions[0].ID, "pages are not modified")
+
+	// Questions missing from the order, such as ones added later, come last.
+	assert.Equal(t, []uint{10, 9}, pageIDs(ApplyOrder(pages, Order{Questions: []uint{10}})[1:]))
+}
+
+func pageIDs(pages []Page) []uint {
+	var ids []uint
+	for _, p := range pages {
+		for _, q := range p.Questions {
+			ids = append(ids, q.ID)
+		}
+	}
+	return ids
+}
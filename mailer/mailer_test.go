@@ -0,0 +1,19 @@
+package mailer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelopeAddress(t *testing.T) {
+	assert.Equal(t, "no-reply@surveyx.local", envelopeAddress("SurveyX <no-reply@surveyx.local>"))
+	assert.Equal(t, "bob@example.com", envelopeAddress("bob@example.com"))
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	m := &SMTPMailer{Addr: "localhost:25", From: "a@example.com"}
+	err := m.Send(context.Background(), Message{To: "b@example.com\r\nBcc: c@example.com", Subject: "hi"})
+	assert.Error(t, err)
+}
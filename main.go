@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"time"
@@ -9,20 +10,32 @@ import (
 	"github.com/nikhilsahni7/SurveyX/auth"
 	"github.com/nikhilsahni7/SurveyX/db"
 	"github.com/nikhilsahni7/SurveyX/handlers"
+	"github.com/nikhilsahni7/SurveyX/mailer"
 	"github.com/nikhilsahni7/SurveyX/middlewares"
+	"github.com/nikhilsahni7/SurveyX/webhooks"
 	"github.com/rs/cors"
 )
 
 func main() {
 	db.InitDB()
 	auth.InitStore()
+	mailer.Init()
+
+	// Webhook delivery workers
+	webhooks.NewDispatcher(db.DB).Start(context.Background())
+
+	// Abandon draft responses that expired and announce surveys that closed
+	handlers.StartSweeper(context.Background(), 15*time.Minute)
 
 	r := mux.NewRouter()
 
+	// Origins of the frontend, allowed by CORS and the CSRF check
+	frontendOrigins := []string{"http://localhost:3000"}
+
 	// CORS Middleware
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedOrigins:   frontendOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
 		AllowCredentials: true,
 	})
@@ -35,36 +48,67 @@ func main() {
 	limiter := middlewares.NewIPRateLimiter(1, 5)
 	r.Use(middlewares.LimitMiddleware(limiter))
 
+	// CSRF protection for cookie sessions
+	r.Use(middlewares.CSRFMiddleware(frontendOrigins))
+	r.HandleFunc("/api/csrf", middlewares.CSRFTokenHandler).Methods("GET")
+
 	// Auth routes
 	r.HandleFunc("/register", handlers.RegisterHandler).Methods("POST")
 	r.HandleFunc("/login", handlers.LoginHandlerEmail).Methods("POST")
-	r.HandleFunc("/login/google", handlers.LoginHandler)
-	r.HandleFunc("/auth/google/callback", handlers.GoogleCallbackHandler)
-	r.HandleFunc("/logout", handlers.LogoutHandler)
+	r.HandleFunc("/login/mfa", handlers.LoginMFAHandler).Methods("POST")
+	r.HandleFunc("/login/{provider}", handlers.LoginHandler).Methods("GET")
+	r.HandleFunc("/auth/{provider}/callback", handlers.OAuthCallbackHandler).Methods("GET")
+	r.HandleFunc("/logout", handlers.LogoutHandler).Methods("POST")
+	r.HandleFunc("/verify-email", handlers.VerifyEmail).Methods("POST")
+	r.HandleFunc("/verify-email/resend", handlers.ResendVerificationEmail).Methods("POST")
+	r.HandleFunc("/password/forgot", handlers.ForgotPassword).Methods("POST")
+	r.HandleFunc("/password/reset", handlers.ResetPassword).Methods("POST")
 	r.HandleFunc("/api/test-auth", auth.AuthMiddleware(handlers.TestAuthHandler))
 	r.HandleFunc("/api/user", auth.AuthMiddleware(handlers.GetCurrentUser)).Methods("GET")
+	r.HandleFunc("/api/user/mfa/setup", auth.AuthMiddleware(handlers.SetupMFA)).Methods("POST")
+	r.HandleFunc("/api/user/mfa/enable", auth.AuthMiddleware(handlers.EnableMFA)).Methods("POST")
+	r.HandleFunc("/api/user/mfa/disable", auth.AuthMiddleware(handlers.DisableMFA)).Methods("POST")
+	r.HandleFunc("/api/user/mfa/recovery-codes", auth.AuthMiddleware(handlers.RegenerateRecoveryCodes)).Methods("POST")
+	r.HandleFunc("/api/user/identities", auth.AuthMiddleware(handlers.ListIdentities)).Methods("GET")
+	r.HandleFunc("/api/user/identities/{id}", auth.AuthMiddleware(handlers.UnlinkIdentity)).Methods("DELETE")
+	r.HandleFunc("/api/user/password", auth.AuthMiddleware(handlers.ChangePassword)).Methods("POST")
+	r.HandleFunc("/api/user/sessions", auth.AuthMiddleware(handlers.ListSessions)).Methods("GET")
+	r.HandleFunc("/api/user/sessions", auth.AuthMiddleware(handlers.RevokeOtherSessions)).Methods("DELETE")
+	r.HandleFunc("/api/user/sessions/{id}", auth.AuthMiddleware(handlers.RevokeSession)).Methods("DELETE")
+	r.HandleFunc("/api/admin/users/{userId}/mfa/reset", auth.AuthMiddleware(handlers.AdminResetMFA)).Methods("POST")
 
 	// Survey routes
 	r.HandleFunc("/api/surveys", auth.AuthMiddleware(handlers.CreateSurvey)).Methods("POST")
-	r.HandleFunc("/api/surveys", auth.AuthMiddleware(handlers.ListSurveys)).Methods("GET")
-	r.HandleFunc("/api/surveys/{id}", auth.AuthMiddleware(handlers.GetSurvey)).Methods("GET")
+	r.HandleFunc("/api/surveys", auth.RequireScope(auth.ScopeSurveysRead, handlers.ListSurveys)).Methods("GET")
+	r.HandleFunc("/api/surveys/{id}", auth.RequireScope(auth.ScopeSurveysRead, handlers.GetSurvey)).Methods("GET")
 	r.HandleFunc("/api/surveys/{id}", auth.AuthMiddleware(handlers.UpdateSurvey)).Methods("PUT")
 	r.HandleFunc("/api/surveys/{id}", auth.AuthMiddleware(handlers.DeleteSurvey)).Methods("DELETE")
+	r.HandleFunc("/api/surveys/{id}/move", auth.AuthMiddleware(handlers.MoveSurvey)).Methods("POST")
 	r.HandleFunc("/api/surveys/{id}/duplicate", auth.AuthMiddleware(handlers.DuplicateSurvey)).Methods("POST")
 	r.HandleFunc("/api/surveys/{id}/publish", auth.AuthMiddleware(handlers.PublishSurvey)).Methods("POST")
 	r.HandleFunc("/api/surveys/{id}/unpublish", auth.AuthMiddleware(handlers.UnpublishSurvey)).Methods("POST")
 
+	// Survey version routes
+	r.HandleFunc("/api/surveys/{id}/versions", auth.RequireScope(auth.ScopeSurveysRead, handlers.ListSurveyVersions)).Methods("GET")
+	r.HandleFunc("/api/surveys/{id}/versions/diff", auth.RequireScope(auth.ScopeSurveysRead, handlers.DiffSurveyVersions)).Methods("GET")
+	r.HandleFunc("/api/surveys/{id}/versions/{version:[0-9]+}", auth.RequireScope(auth.ScopeSurveysRead, handlers.GetSurveyVersion)).Methods("GET")
+
 	// Response routes
 	r.HandleFunc("/api/surveys/{id}/submit", handlers.SubmitResponse).Methods("POST")
-	r.HandleFunc("/api/surveys/{id}/responses", auth.AuthMiddleware(handlers.ListResponses)).Methods("GET")
-	r.HandleFunc("/api/surveys/{id}/responses/{responseId}", auth.AuthMiddleware(handlers.GetResponse)).Methods("GET")
+	r.HandleFunc("/api/surveys/{id}/drafts", handlers.StartDraftResponse).Methods("POST")
+	r.HandleFunc("/api/surveys/{id}/draft", handlers.GetDraftResponse).Methods("GET")
+	r.HandleFunc("/api/surveys/{id}/draft", handlers.SaveDraftAnswers).Methods("PATCH")
+	r.HandleFunc("/api/surveys/{id}/draft/submit", handlers.SubmitDraftResponse).Methods("POST")
+	r.HandleFunc("/api/surveys/{id}/responses", auth.RequireScope(auth.ScopeResponsesRead, handlers.ListResponses)).Methods("GET")
+	r.HandleFunc("/api/surveys/{id}/responses/{responseId}", auth.RequireScope(auth.ScopeResponsesRead, handlers.GetResponse)).Methods("GET")
+	r.HandleFunc("/api/surveys/{id}/responses/{responseId}", auth.RequireScope(auth.ScopeResponsesWrite, handlers.DeleteResponse)).Methods("DELETE")
 
 	// Public survey access
 	r.HandleFunc("/api/s/{linkID}", handlers.AccessSurveyByLink).Methods("GET")
 
 	// Analytics routes
-	r.HandleFunc("/api/surveys/{id}/analytics", auth.AuthMiddleware(handlers.GetSurveyAnalytics)).Methods("GET")
-	r.HandleFunc("/api/surveys/{id}/export", auth.AuthMiddleware(handlers.ExportSurveyData)).Methods("GET")
+	r.HandleFunc("/api/surveys/{id}/analytics", auth.RequireScope(auth.ScopeResponsesRead, handlers.GetSurveyAnalytics)).Methods("GET")
+	r.HandleFunc("/api/surveys/{id}/export", auth.RequireScope(auth.ScopeResponsesRead, handlers.ExportSurveyData)).Methods("GET")
 
 	// Team routes
 	r.HandleFunc("/api/teams", auth.AuthMiddleware(handlers.CreateTeam)).Methods("POST")
@@ -72,13 +116,30 @@ func main() {
 	r.HandleFunc("/api/teams/{teamId}", auth.AuthMiddleware(handlers.GetTeam)).Methods("GET")
 	r.HandleFunc("/api/teams/{teamId}", auth.AuthMiddleware(handlers.UpdateTeam)).Methods("PUT")
 	r.HandleFunc("/api/teams/{teamId}/members", auth.AuthMiddleware(handlers.AddTeamMember)).Methods("POST")
+	r.HandleFunc("/api/teams/{teamId}/members/{userId}", auth.AuthMiddleware(handlers.UpdateTeamMemberRole)).Methods("PUT")
 	r.HandleFunc("/api/teams/{teamId}/members/{userId}", auth.AuthMiddleware(handlers.RemoveTeamMember)).Methods("DELETE")
+	r.HandleFunc("/api/teams/{teamId}/transfer-ownership", auth.AuthMiddleware(handlers.TransferTeamOwnership)).Methods("POST")
+	r.HandleFunc("/api/teams/{teamId}/invitations", auth.AuthMiddleware(handlers.ListTeamInvitations)).Methods("GET")
+	r.HandleFunc("/api/teams/{teamId}/invitations/{invitationId}/resend", auth.AuthMiddleware(handlers.ResendTeamInvitation)).Methods("POST")
+	r.HandleFunc("/api/teams/{teamId}/invitations/{invitationId}", auth.AuthMiddleware(handlers.RevokeTeamInvitation)).Methods("DELETE")
+	r.HandleFunc("/api/invitations/accept", auth.AuthMiddleware(handlers.AcceptTeamInvitation)).Methods("POST")
+
+	// Access token routes
+	r.HandleFunc("/api/tokens", auth.AuthMiddleware(handlers.ListAccessTokens)).Methods("GET")
+	r.HandleFunc("/api/tokens", auth.AuthMiddleware(handlers.CreateAccessToken)).Methods("POST")
+	r.HandleFunc("/api/tokens/{id}", auth.AuthMiddleware(handlers.DeleteAccessToken)).Methods("DELETE")
 
 	// Webhook routes
-	r.HandleFunc("/api/webhooks", auth.AuthMiddleware(handlers.CreateWebhook)).Methods("POST")
-	r.HandleFunc("/api/webhooks", auth.AuthMiddleware(handlers.ListWebhooks)).Methods("GET")
-	r.HandleFunc("/api/webhooks/{id}", auth.AuthMiddleware(handlers.UpdateWebhook)).Methods("PUT")
-	r.HandleFunc("/api/webhooks/{id}", auth.AuthMiddleware(handlers.DeleteWebhook)).Methods("DELETE")
+	r.HandleFunc("/api/webhooks", auth.RequireScope(auth.ScopeWebhooksAdmin, handlers.CreateWebhook)).Methods("POST")
+	r.HandleFunc("/api/webhooks", auth.RequireScope(auth.ScopeWebhooksAdmin, handlers.ListWebhooks)).Methods("GET")
+	r.HandleFunc("/api/webhooks/events", auth.RequireScope(auth.ScopeWebhooksAdmin, handlers.ListWebhookEvents)).Methods("GET")
+	r.HandleFunc("/api/webhooks/{id}", auth.RequireScope(auth.ScopeWebhooksAdmin, handlers.UpdateWebhook)).Methods("PUT")
+	r.HandleFunc("/api/webhooks/{id}", auth.RequireScope(auth.ScopeWebhooksAdmin, handlers.DeleteWebhook)).Methods("DELETE")
+	r.HandleFunc("/api/webhooks/{id}/test", auth.RequireScope(auth.ScopeWebhooksAdmin, handlers.TestWebhook)).Methods("POST")
+	r.HandleFunc("/api/webhooks/{id}/preview", auth.RequireScope(auth.ScopeWebhooksAdmin, handlers.PreviewWebhookEvent)).Methods("GET")
+	r.HandleFunc("/api/webhooks/{id}/rotate-secret", auth.RequireScope(auth.ScopeWebhooksAdmin, handlers.RotateWebhookSecret)).Methods("POST")
+	r.HandleFunc("/api/webhooks/{id}/deliveries", auth.RequireScope(auth.ScopeWebhooksAdmin, handlers.ListWebhookDeliveries)).Methods("GET")
+	r.HandleFunc("/api/webhooks/{id}/deliveries/{deliveryId}/redeliver", auth.RequireScope(auth.ScopeWebhooksAdmin, handlers.RedeliverWebhookDelivery)).Methods("POST")
 
 	handler := c.Handler(r)
 
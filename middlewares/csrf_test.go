@@ -0,0 +1,99 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	handler := CSRFMiddleware([]string{"http://localhost:3000"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		cookies map[string]string
+		want    int
+	}{
+		{name: "safe method", method: "GET", headers: map[string]string{"Origin": "https://evil.example"}, cookies: map[string]string{sessionCookie: "s"}, want: http.StatusNoContent},
+		{name: "no session, trusted origin", method: "POST", headers: map[string]string{"Origin": "http://localhost:3000"}, want: http.StatusNoContent},
+		{name: "no session, foreign origin", method: "POST", headers: map[string]string{"Origin": "https://evil.example"}, want: http.StatusForbidden},
+		{name: "foreign referer", method: "POST", headers: map[string]string{"Referer": "https://evil.example/page"}, want: http.StatusForbidden},
+		{name: "null origin", method: "POST", headers: map[string]string{"Origin": "null"}, want: http.StatusForbidden},
+		{name: "same host", method: "POST", headers: map[string]string{"Origin": "http://api.example.com"}, want: http.StatusNoContent},
+		{name: "session without token", method: "POST", headers: map[string]string{"Origin": "http://localhost:3000"}, cookies: map[string]string{sessionCookie: "s"}, want: http.StatusForbidden},
+		{
+			name:    "session with wrong token",
+			method:  "DELETE",
+			headers: map[string]string{CSRFHeader: "other"},
+			cookies: map[string]string{sessionCookie: "s", CSRFCookie: "token"},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "session with token",
+			method:  "PUT",
+			headers: map[string]string{"Origin": "http://localhost:3000", CSRFHeader: "token"},
+			cookies: map[string]string{sessionCookie: "s", CSRFCookie: "token"},
+			want:    http.StatusNoContent,
+		},
+		{
+			name:    "session with token from foreign origin",
+			method:  "POST",
+			headers: map[string]string{"Origin": "https://evil.example", CSRFHeader: "token"},
+			cookies: map[string]string{sessionCookie: "s", CSRFCookie: "token"},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "bearer token",
+			method:  "POST",
+			headers: map[string]string{"Origin": "https://evil.example", "Authorization": "Bearer sxp_token"},
+			cookies: map[string]string{sessionCookie: "s"},
+			want:    http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://api.example.com/api/surveys", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			for k, v := range tt.cookies {
+				req.AddCookie(&http.Cookie{Name: k, Value: v})
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, tt.want, rr.Code)
+		})
+	}
+}
+
+func TestCSRFTokenHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	CSRFTokenHandler(rr, httptest.NewRequest("GET", "/api/csrf", nil))
+
+	var body map[string]string
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+	token := body["csrfToken"]
+	assert.NotEmpty(t, token)
+
+	cookies := rr.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, CSRFCookie, cookies[0].Name)
+	assert.Equal(t, token, cookies[0].Value)
+
+	// An existing token is kept so open tabs keep working.
+	req := httptest.NewRequest("GET", "/api/csrf", nil)
+	req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: token})
+	rr = httptest.NewRecorder()
+	CSRFTokenHandler(rr, req)
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+	assert.Equal(t, token, body["csrfToken"])
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// EventList is the set of events a webhook is subscribed to. It is stored as a
+// JSON array in a text column. Values written before the list existed were a
+// free-form comma separated string and are still read.
+type EventList []string
+
+// Has reports whether event is in the list.
+func (l EventList) Has(event string) bool {
+	for _, e := range l {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (l EventList) Value() (driver.Value, error) {
+	if l == nil {
+		l = EventList{}
+	}
+	b, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (l *EventList) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into EventList", src)
+	}
+	return l.parse(s)
+}
+
+// UnmarshalJSON accepts an array of event names or, for older clients, a comma
+// separated string.
+func (l *EventList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return l.parse(s)
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+func (l *EventList) parse(s string) error {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "[") {
+		var list []string
+		if err := json.Unmarshal([]byte(s), &list); err != nil {
+			return err
+		}
+		*l = list
+		return nil
+	}
+
+	list := EventList{}
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	*l = list
+	return nil
+}
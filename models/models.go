@@ -12,10 +12,90 @@ type User struct {
 	Name         string
 	GoogleID     *string `gorm:"uniqueIndex"`
 	Picture      string
-	PasswordHash string
+	PasswordHash string `json:"-"`
 	Surveys      []Survey
 	Teams        []Team `gorm:"many2many:user_teams;"`
+	// EmailVerifiedAt is set once the user proved they own Email.
+	EmailVerifiedAt *time.Time
+	IsAdmin         bool
+	// MFASecret is the TOTP secret once two-factor authentication is enabled;
+	// MFAPendingSecret holds the secret being enrolled until it is confirmed.
+	// MFALastStep is the TOTP period of the last accepted code.
+	MFASecret        string `json:"-"`
+	MFAPendingSecret string `json:"-"`
+	MFALastStep      int64  `json:"-"`
+	MFAEnabledAt     *time.Time
 }
+
+// LoginThrottle counts recent failed logins for one key, either an account
+// ("account:<email>") or a client address ("ip:<address>").
+type LoginThrottle struct {
+	Key           string `gorm:"primaryKey"`
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+	UpdatedAt     time.Time
+}
+
+// LoginAttempt is the audit record of a login attempt. UserID is nil when the
+// email does not belong to an account.
+type LoginAttempt struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	Email     string    `gorm:"index"`
+	UserID    *uint     `gorm:"index"`
+	IP        string    `gorm:"index"`
+	UserAgent string
+	Success   bool
+	Reason    string
+}
+
+// MFARecoveryCode is a single use code that replaces a TOTP code when the
+// user has lost their authenticator. Only its hash is stored.
+type MFARecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"index"`
+	UsedAt   *time.Time
+}
+
+// UserSession records a signed in browser session. The session cookie holds
+// a random ID whose hash is stored here; revoking the record signs the
+// browser out.
+type UserSession struct {
+	gorm.Model
+	UserID     uint   `gorm:"index"`
+	TokenHash  string `gorm:"uniqueIndex" json:"-"`
+	IP         string
+	UserAgent  string
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
+
+// Identity links a User to an account at an external login provider. A user
+// can have several identities besides their password.
+type Identity struct {
+	gorm.Model
+	UserID      uint   `gorm:"index"`
+	Provider    string `gorm:"uniqueIndex:idx_identities_provider_subject"`
+	Subject     string `gorm:"uniqueIndex:idx_identities_provider_subject"`
+	Email       string
+	LastLoginAt *time.Time
+}
+
+// UserToken is a single use token mailed to a user, for example to verify
+// their email or reset their password. TokenHash is keyed with the server
+// secret so stored hashes cannot be turned back into working tokens.
+type UserToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	Purpose   string `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
 type Team struct {
 	gorm.Model
 	Name    string
@@ -24,12 +104,56 @@ type Team struct {
 	Surveys []Survey
 }
 
+// TeamMember is the user_teams join row between User and Team. Role is one of
+// owner, admin, editor, analyst or viewer (see package authz).
+type TeamMember struct {
+	UserID    uint   `gorm:"primaryKey"`
+	TeamID    uint   `gorm:"primaryKey"`
+	Role      string `gorm:"not null;default:editor"`
+	CreatedAt time.Time
+}
+
+func (TeamMember) TableName() string {
+	return "user_teams"
+}
+
+// TeamInvitation invites an email address to a team. The token sent by email
+// is single use and only its hash is stored. Status is pending, accepted,
+// revoked or expired.
+type TeamInvitation struct {
+	gorm.Model
+	TeamID       uint
+	Email        string `gorm:"index"`
+	Role         string
+	TokenHash    string `gorm:"uniqueIndex" json:"-"`
+	Status       string `gorm:"index"`
+	ExpiresAt    time.Time
+	InvitedByID  uint
+	AcceptedByID *uint
+	AcceptedAt   *time.Time
+}
+
+// AccessToken is a personal access token that lets scripts call the API as
+// its user. Only the hash of the token is stored; Prefix is kept so users can
+// tell their tokens apart. Scopes is a space separated list.
+type AccessToken struct {
+	gorm.Model
+	UserID     uint `gorm:"index"`
+	Name       string
+	Prefix     string
+	TokenHash  string `gorm:"uniqueIndex" json:"-"`
+	Scopes     string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
 type Survey struct {
 	gorm.Model
 	UserID        uint
 	TeamID        *uint
 	Title         string
 	Description   string
+	Sections      []Section
 	Questions     []Question
 	ResponseLimit *int
 	ReleaseDate   *time.Time
@@ -41,21 +165,57 @@ type Survey struct {
 	Link          string
 	IsPublished   bool
 	Version       int
+	// ClosedEventAt is set once survey.closed has been queued, so that the
+	// event is sent only once per survey.
+	ClosedEventAt *time.Time `json:"-"`
+}
+
+// Section is a page of a survey. Surveys without sections are shown as a
+// single page.
+type Section struct {
+	gorm.Model
+	SurveyID    uint `gorm:"index"`
+	Title       string
+	Description string
+	Order       int
+	// ShuffleQuestions shows the questions of the section in a random order
+	// per respondent.
+	ShuffleQuestions bool
+	Rules            []PageRule
+}
+
+// PageRule decides where respondents go after finishing a section: when the
+// answer to QuestionID matches, they skip to GoToSectionID, or to the end of
+// the survey if it is nil. The rules of a section are tried in Order and the
+// first match wins; without a match respondents go on to the next section.
+type PageRule struct {
+	gorm.Model
+	SectionID     uint `gorm:"index"`
+	Order         int
+	QuestionID    uint
+	Operator      string
+	Value         string
+	GoToSectionID *uint
 }
 
 type Question struct {
 	gorm.Model
 	SurveyID      uint
+	SectionID     *uint
 	Text          string
 	Type          string
-	Options       []Option `gorm:"foreignKey:QuestionID"`
+	Options       []Option    `gorm:"foreignKey:QuestionID"`
+	Rows          []MatrixRow `gorm:"foreignKey:QuestionID"`
 	IsRequired    bool
 	Order         int
 	MinValue      *int
 	MaxValue      *int
 	AllowMultiple bool
 	MaxFileSize   *int
-	Conditions    []Condition
+	// ShuffleOptions shows the options in a random order per respondent,
+	// except pinned ones.
+	ShuffleOptions bool
+	Conditions     []Condition
 }
 
 type Condition struct {
@@ -64,6 +224,7 @@ type Condition struct {
 	DependentOnID    uint
 	DependentOnValue string
 	Operator         string // e.g., "equals", "not equals", "greater than", etc.
+	Group            int    // conditions in the same group are ANDed, groups are ORed
 }
 
 type Option struct {
@@ -71,16 +232,51 @@ type Option struct {
 	QuestionID uint
 	Text       string
 	Value      string
+	// Pinned keeps the option in place when options are shuffled, as for
+	// "Other" or "None of the above".
+	Pinned bool
 }
 
+// MatrixRow is one row of a matrix question. The options of a matrix question
+// are its columns.
+type MatrixRow struct {
+	gorm.Model
+	QuestionID uint
+	Text       string
+	Value      string
+}
+
+// Response is a set of answers to a survey. Status is completed for submitted
+// responses, draft while a respondent is still filling it in, and abandoned
+// once a draft expired. Only completed responses count as responses.
 type Response struct {
 	gorm.Model
 	SurveyID  uint
+	Version   int // survey version that was answered
 	Answers   []Answer
 	IP        string
 	UserAgent string
+	Status    string `gorm:"index;not null;default:completed"`
+	// ResumeTokenHash finds a draft by the token its respondent holds.
+	ResumeTokenHash string `gorm:"index" json:"-"`
+	ExpiresAt       *time.Time
+	CompletedAt     *time.Time
+	// DisplayOrder holds the JSON encoded logic.Order the questions and
+	// options were shown in.
+	DisplayOrder string `gorm:"type:jsonb;not null;default:'{}'"`
 }
 
+// Answer holds the answer to one question. Value is encoded by question type:
+//
+//   - choice questions store the option value, or a JSON array of values when
+//     several can be selected
+//   - matrix stores a JSON object from row value to column value, or to a JSON
+//     array of column values with AllowMultiple
+//   - ranking stores a JSON array of option values, best first
+//   - rating, scale and nps store a whole number, number a decimal number
+//   - date stores YYYY-MM-DD, time HH:MM and datetime an RFC 3339 timestamp
+//   - email stores the bare address and phone an E.164 number like +14155550100
+//   - text questions store the text as entered
 type Answer struct {
 	gorm.Model
 	ResponseID uint
@@ -90,6 +286,20 @@ type Answer struct {
 	Question   Question `gorm:"foreignKey:QuestionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 }
 
+// SurveyVersion is an immutable snapshot of a survey revision that has been
+// live. Questions holds the JSON encoded question set, including options and
+// conditions, with the question IDs that answers to this version reference.
+// Sections holds the sections with their page rules the same way.
+type SurveyVersion struct {
+	gorm.Model
+	SurveyID    uint `gorm:"uniqueIndex:idx_survey_versions_survey_version"`
+	Version     int  `gorm:"uniqueIndex:idx_survey_versions_survey_version"`
+	Title       string
+	Description string
+	Questions   string `gorm:"type:jsonb"`
+	Sections    string `gorm:"type:jsonb;not null;default:'[]'"`
+}
+
 type SurveyLink struct {
 	gorm.Model
 	SurveyID uint
@@ -102,6 +312,38 @@ type Webhook struct {
 	UserID   uint
 	SurveyID uint
 	URL      string
-	Events   string
+	Events   EventList `gorm:"type:text"`
 	Secret   string
+	// PreviousSecret keeps signing requests after a rotation until
+	// PreviousSecretExpiresAt so receivers can switch over.
+	PreviousSecret          string     `json:"-"`
+	PreviousSecretExpiresAt *time.Time `json:"-"`
+}
+
+// WebhookDelivery is an event queued for delivery to a webhook. Deliveries are
+// the outbox the webhook workers poll; Status is pending, succeeded or dead
+// once MaxAttempts have failed.
+type WebhookDelivery struct {
+	gorm.Model
+	WebhookID     uint `gorm:"index"`
+	Event         string
+	Payload       string `gorm:"type:jsonb"`
+	Status        string `gorm:"index:idx_webhook_deliveries_due"`
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index:idx_webhook_deliveries_due"`
+	LastError     string
+	DeliveredAt   *time.Time
+	AttemptLog    []WebhookAttempt `gorm:"foreignKey:DeliveryID"`
+}
+
+// WebhookAttempt records a single HTTP request made for a delivery.
+type WebhookAttempt struct {
+	gorm.Model
+	DeliveryID   uint `gorm:"index"`
+	StatusCode   int
+	LatencyMs    int64
+	ResponseBody string
+	Error        string
+	// Blocked is set when the URL policy refused to connect to the target.
+	Blocked bool
 }
@@ -0,0 +1,206 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+)
+
+// DateTimeLayouts are the layouts of date and time answers by question type.
+var DateTimeLayouts = map[string]string{
+	"date":     "2006-01-02",
+	"time":     "15:04",
+	"datetime": time.RFC3339,
+}
+
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// RowValue is the key of a matrix row in Answer.Value. Rows without an
+// explicit Value fall back to their Text, like options.
+func RowValue(r models.MatrixRow) string {
+	if r.Value != "" {
+		return r.Value
+	}
+	return r.Text
+}
+
+// DecodeMatrix decodes a matrix answer into the selected columns of each row.
+// Rows of single choice matrices map to a single column.
+func DecodeMatrix(value string) (map[string][]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, err
+	}
+	rows := make(map[string][]string, len(raw))
+	for row, cell := range raw {
+		var single string
+		if err := json.Unmarshal(cell, &single); err == nil {
+			rows[row] = []string{single}
+			continue
+		}
+		var multi []string
+		if err := json.Unmarshal(cell, &multi); err != nil {
+			return nil, fmt.Errorf("row %q: %w", row, err)
+		}
+		rows[row] = multi
+	}
+	return rows, nil
+}
+
+// validateMatrix checks that rows and columns exist and, for single choice
+// matrices, that each row has one column.
+func validateMatrix(q models.Question, value string) *FieldError {
+	rows, err := DecodeMatrix(value)
+	if err != nil {
+		fe := fieldError(q.ID, CodeInvalidFormat, "answer must be a JSON object from row to column")
+		return &fe
+	}
+
+	columns := make(map[string]bool, len(q.Options))
+	for _, o := range q.Options {
+		columns[OptionValue(o)] = true
+	}
+	known := make(map[string]bool, len(q.Rows))
+	for _, r := range q.Rows {
+		known[RowValue(r)] = true
+	}
+
+	for row, selected := range rows {
+		if !known[row] {
+			fe := fieldError(q.ID, CodeInvalidRow, fmt.Sprintf("%q is not a row of this question", row))
+			return &fe
+		}
+		if len(selected) > 1 && !q.AllowMultiple {
+			fe := fieldError(q.ID, CodeMultipleNotAllowed, fmt.Sprintf("only one column may be selected in row %q", row))
+			return &fe
+		}
+		for _, s := range selected {
+			if !columns[s] {
+				fe := fieldError(q.ID, CodeInvalidOption, fmt.Sprintf("%q is not a valid column", s))
+				return &fe
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkComplete requires an answer in every row of required matrices. It is
+// only applied to complete responses, so drafts can fill a matrix row by row.
+func checkComplete(q models.Question, value string) *FieldError {
+	if q.Type != "matrix" || !q.IsRequired {
+		return nil
+	}
+	rows, err := DecodeMatrix(value)
+	if err != nil {
+		return nil
+	}
+	for _, r := range q.Rows {
+		if len(rows[RowValue(r)]) == 0 {
+			fe := fieldError(q.ID, CodeIncomplete, fmt.Sprintf("row %q must be answered", RowValue(r)))
+			return &fe
+		}
+	}
+	return nil
+}
+
+// validateRanking checks that a ranking lists distinct options, best first.
+// Every option must be ranked, or exactly MaxValue of them for "top N"
+// rankings.
+func validateRanking(q models.Question, value string) *FieldError {
+	var ranked []string
+	if err := json.Unmarshal([]byte(value), &ranked); err != nil {
+		fe := fieldError(q.ID, CodeInvalidFormat, "answer must be a JSON array of options")
+		return &fe
+	}
+
+	allowed := make(map[string]bool, len(q.Options))
+	for _, o := range q.Options {
+		allowed[OptionValue(o)] = true
+	}
+	seen := make(map[string]bool, len(ranked))
+	for _, r := range ranked {
+		if !allowed[r] {
+			fe := fieldError(q.ID, CodeInvalidOption, fmt.Sprintf("%q is not a valid option", r))
+			return &fe
+		}
+		if seen[r] {
+			fe := fieldError(q.ID, CodeInvalidRanking, fmt.Sprintf("%q is ranked more than once", r))
+			return &fe
+		}
+		seen[r] = true
+	}
+
+	want := len(q.Options)
+	if q.MaxValue != nil && *q.MaxValue < want {
+		want = *q.MaxValue
+	}
+	if len(ranked) != want {
+		fe := fieldError(q.ID, CodeInvalidRanking, fmt.Sprintf("rank exactly %d options", want))
+		return &fe
+	}
+	return nil
+}
+
+// validateNPS checks Net Promoter Score answers, which are always 0 to 10.
+func validateNPS(q models.Question, value string) *FieldError {
+	lowest, highest := 0, 10
+	q.MinValue, q.MaxValue = &lowest, &highest
+	return validateInteger(q, value)
+}
+
+// validateNumber checks decimal answers against MinValue and MaxValue.
+func validateNumber(q models.Question, value string) *FieldError {
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		fe := fieldError(q.ID, CodeNotANumber, "answer must be a number")
+		return &fe
+	}
+	if q.MinValue != nil && n < float64(*q.MinValue) {
+		fe := fieldError(q.ID, CodeBelowMinimum, fmt.Sprintf("answer must be at least %d", *q.MinValue))
+		return &fe
+	}
+	if q.MaxValue != nil && n > float64(*q.MaxValue) {
+		fe := fieldError(q.ID, CodeAboveMaximum, fmt.Sprintf("answer must be at most %d", *q.MaxValue))
+		return &fe
+	}
+	return nil
+}
+
+// validateDateTime checks date, time and datetime answers against the layout
+// of their type.
+func validateDateTime(q models.Question, value string) *FieldError {
+	layout := DateTimeLayouts[q.Type]
+	if _, err := time.Parse(layout, value); err != nil {
+		fe := fieldError(q.ID, CodeInvalidDate, fmt.Sprintf("answer must be a %s in the form %s", q.Type, layout))
+		return &fe
+	}
+	return nil
+}
+
+// validateEmail accepts a bare email address, without a display name.
+func validateEmail(q models.Question, value string) *FieldError {
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Name != "" || addr.Address != value || len(value) > 254 {
+		fe := fieldError(q.ID, CodeInvalidEmail, "answer must be an email address")
+		return &fe
+	}
+	return nil
+}
+
+// validatePhone accepts phone numbers in E.164 form, which frontends format
+// into before submitting.
+func validatePhone(q models.Question, value string) *FieldError {
+	if !phonePattern.MatchString(value) {
+		fe := fieldError(q.ID, CodeInvalidPhone, "answer must be a phone number in international format, like +14155550100")
+		return &fe
+	}
+	return nil
+}
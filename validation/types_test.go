@@ -0,0 +1,138 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestQuestionTypes(t *testing.T) {
+	columns := []models.Option{{Value: "bad"}, {Value: "ok"}, {Value: "good"}}
+	rows := []models.MatrixRow{{Value: "price"}, {Text: "support"}}
+	options := []models.Option{{Value: "a"}, {Value: "b"}, {Value: "c"}}
+
+	tests := []struct {
+		name     string
+		question models.Question
+		valid    []string
+		invalid  map[string]string
+	}{
+		{
+			name:     "matrix",
+			question: models.Question{Type: "matrix", Options: columns, Rows: rows},
+			valid:    []string{`{"price":"bad","support":"good"}`, `{"price":"ok"}`},
+			invalid: map[string]string{
+				`["bad"]`:                    CodeInvalidFormat,
+				`{"speed":"ok"}`:             CodeInvalidRow,
+				`{"price":"great"}`:          CodeInvalidOption,
+				`{"price":["bad","good"]}`:   CodeMultipleNotAllowed,
+				`{"price":"ok","support":1}`: CodeInvalidFormat,
+			},
+		},
+		{
+			name:     "matrix with multiple columns",
+			question: models.Question{Type: "matrix", AllowMultiple: true, Options: columns, Rows: rows},
+			valid:    []string{`{"price":["bad","good"],"support":"ok"}`},
+			invalid:  map[string]string{`{"support":["ok","meh"]}`: CodeInvalidOption},
+		},
+		{
+			name:     "ranking",
+			question: models.Question{Type: "ranking", Options: options},
+			valid:    []string{`["c","a","b"]`},
+			invalid: map[string]string{
+				`c,a,b`:         CodeInvalidFormat,
+				`["c","a"]`:     CodeInvalidRanking,
+				`["c","a","a"]`: CodeInvalidRanking,
+				`["c","a","d"]`: CodeInvalidOption,
+			},
+		},
+		{
+			name:     "top two ranking",
+			question: models.Question{Type: "ranking", Options: options, MaxValue: intPtr(2)},
+			valid:    []string{`["b","c"]`},
+			invalid:  map[string]string{`["b","c","a"]`: CodeInvalidRanking},
+		},
+		{
+			name:     "nps",
+			question: models.Question{Type: "nps"},
+			valid:    []string{"0", "10"},
+			invalid:  map[string]string{"11": CodeAboveMaximum, "-1": CodeBelowMinimum, "7.5": CodeNotANumber},
+		},
+		{
+			name:     "number",
+			question: models.Question{Type: "number", MinValue: intPtr(0), MaxValue: intPtr(100)},
+			valid:    []string{"0", "42.5", "1e2"},
+			invalid:  map[string]string{"abc": CodeNotANumber, "NaN": CodeNotANumber, "100.1": CodeAboveMaximum, "-0.5": CodeBelowMinimum},
+		},
+		{
+			name:     "date",
+			question: models.Question{Type: "date"},
+			valid:    []string{"2024-02-29"},
+			invalid:  map[string]string{"2023-02-29": CodeInvalidDate, "29/02/2024": CodeInvalidDate},
+		},
+		{
+			name:     "time",
+			question: models.Question{Type: "time"},
+			valid:    []string{"09:30", "23:59"},
+			invalid:  map[string]string{"24:00": CodeInvalidDate, "9:30 AM": CodeInvalidDate},
+		},
+		{
+			name:     "datetime",
+			question: models.Question{Type: "datetime"},
+			valid:    []string{"2024-05-01T09:30:00Z", "2024-05-01T09:30:00+02:00"},
+			invalid:  map[string]string{"2024-05-01 09:30": CodeInvalidDate},
+		},
+		{
+			name:     "email",
+			question: models.Question{Type: "email"},
+			valid:    []string{"ada@example.com"},
+			invalid:  map[string]string{"ada": CodeInvalidEmail, "Ada <ada@example.com>": CodeInvalidEmail, " ada@example.com": CodeInvalidEmail},
+		},
+		{
+			name:     "phone",
+			question: models.Question{Type: "phone"},
+			valid:    []string{"+14155550100", "+442071838750"},
+			invalid:  map[string]string{"4155550100": CodeInvalidPhone, "+1 415 555 0100": CodeInvalidPhone, "+0123456789": CodeInvalidPhone},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.question
+			q.ID = 1
+			for _, value := range tt.valid {
+				assert.Nil(t, validateValue(q, value), value)
+			}
+			for value, code := range tt.invalid {
+				fe := validateValue(q, value)
+				if assert.NotNil(t, fe, value) {
+					assert.Equal(t, code, fe.Code, value)
+				}
+			}
+		})
+	}
+}
+
+func TestRequiredMatrix(t *testing.T) {
+	questions := []models.Question{{
+		Model:      gorm.Model{ID: 1},
+		Type:       "matrix",
+		IsRequired: true,
+		Options:    []models.Option{{Value: "yes"}, {Value: "no"}},
+		Rows:       []models.MatrixRow{{Value: "a"}, {Value: "b"}},
+	}}
+	partial := []models.Answer{{QuestionID: 1, Value: `{"a":"yes"}`}}
+
+	// Drafts may be saved with rows still open, complete responses not.
+	assert.NoError(t, ValidateAnswers(questions, partial))
+	assert.Equal(t, map[uint]string{1: CodeIncomplete}, fieldCodes(t, ValidateResponse(questions, partial)))
+	assert.Equal(t, map[uint]string{1: CodeRequired}, fieldCodes(t, ValidateResponse(questions, []models.Answer{{QuestionID: 1, Value: "{}"}})))
+	assert.NoError(t, ValidateResponse(questions, []models.Answer{{QuestionID: 1, Value: `{"a":"yes","b":"no"}`}}))
+}
+
+func TestRequiredTextAcceptsBraces(t *testing.T) {
+	questions := []models.Question{{Model: gorm.Model{ID: 1}, Type: "text", IsRequired: true}}
+	assert.NoError(t, ValidateResponse(questions, []models.Answer{{QuestionID: 1, Value: "{}"}}))
+}
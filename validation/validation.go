@@ -0,0 +1,328 @@
+// Package validation checks submitted answers against the schema of a survey.
+//
+// Checks that apply to every question (membership, visibility, required) are
+// done here; type specific checks are looked up by QuestionType. Unknown
+// types only get the generic checks.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nikhilsahni7/SurveyX/logic"
+	"github.com/nikhilsahni7/SurveyX/models"
+)
+
+// Error codes reported in FieldError.Code.
+const (
+	CodeUnknownQuestion    = "unknown_question"
+	CodeDuplicateAnswer    = "duplicate_answer"
+	CodeHidden             = "hidden"
+	CodeRequired           = "required"
+	CodeInvalidOption      = "invalid_option"
+	CodeMultipleNotAllowed = "multiple_not_allowed"
+	CodeTooFewSelections   = "too_few_selections"
+	CodeTooManySelections  = "too_many_selections"
+	CodeNotANumber         = "not_a_number"
+	CodeBelowMinimum       = "below_minimum"
+	CodeAboveMaximum       = "above_maximum"
+	CodeTooShort           = "too_short"
+	CodeTooLong            = "too_long"
+	CodeInvalidFormat      = "invalid_format"
+	CodeInvalidRow         = "invalid_row"
+	CodeIncomplete         = "incomplete"
+	CodeInvalidRanking     = "invalid_ranking"
+	CodeInvalidDate        = "invalid_date"
+	CodeInvalidEmail       = "invalid_email"
+	CodeInvalidPhone       = "invalid_phone"
+)
+
+// FieldError describes why the answer to one question was rejected.
+// SectionID is the page of the question in surveys with sections.
+type FieldError struct {
+	QuestionID uint   `json:"questionId"`
+	SectionID  *uint  `json:"sectionId,omitempty"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+// ErrPageNotReached is returned by ValidatePage for a page the respondent's
+// answers skip.
+var ErrPageNotReached = errors.New("page is skipped by the answers given so far")
+
+// Error is returned when a submission fails validation. It lists every
+// failing field, not only the first one.
+type Error struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("validation failed for %d field(s)", len(e.Fields))
+}
+
+// validator checks a non-empty answer against its question.
+type validator func(q models.Question, value string) *FieldError
+
+var validators = map[string]validator{
+	"multipleChoice": validateChoice,
+	"dropdown":       validateChoice,
+	"checkbox":       validateChoice,
+	"rating":         validateInteger,
+	"scale":          validateInteger,
+	"text":           validateText,
+	"textarea":       validateText,
+	"matrix":         validateMatrix,
+	"ranking":        validateRanking,
+	"nps":            validateNPS,
+	"number":         validateNumber,
+	"date":           validateDateTime,
+	"time":           validateDateTime,
+	"datetime":       validateDateTime,
+	"email":          validateEmail,
+	"phone":          validatePhone,
+}
+
+// typeAliases maps other spellings of question types to the canonical ones.
+var typeAliases = map[string]string{
+	"multiple_choice": "multipleChoice",
+}
+
+// QuestionType returns the canonical type of q, so that code switching on
+// the type handles every spelling alike.
+func QuestionType(q models.Question) string {
+	if canonical, ok := typeAliases[q.Type]; ok {
+		return canonical
+	}
+	return q.Type
+}
+
+// ValidateResponse validates answers against questions, which must include
+// their Options and Conditions. It returns nil or an *Error.
+func ValidateResponse(questions []models.Question, answers []models.Answer) error {
+	return ValidateSurveyResponse(nil, questions, answers)
+}
+
+// ValidateSurveyResponse is ValidateResponse for surveys with sections, whose
+// page rules may skip pages. Questions on skipped pages count as hidden.
+func ValidateSurveyResponse(sections []models.Section, questions []models.Question, answers []models.Answer) error {
+	values, fields := collectValues(questions, answers)
+
+	visible := logic.VisibleOnPath(logic.Pages(sections, questions), values)
+	fields = append(fields, checkQuestions(questions, values, visible)...)
+
+	if len(fields) > 0 {
+		return &Error{Fields: fields}
+	}
+	return nil
+}
+
+// ValidatePage checks the page of section sectionID (0 for surveys without
+// sections) once the respondent finishes it: every visible question on it
+// must be answered as required and valid. Answers on other pages are only
+// used to evaluate the survey logic. It returns nil, ErrPageNotReached or an
+// *Error.
+func ValidatePage(sections []models.Section, questions []models.Question, sectionID uint, answers []models.Answer) error {
+	values, fields := collectValues(questions, answers)
+
+	pages := logic.Pages(sections, questions)
+	current := -1
+	for _, i := range logic.Path(pages, values) {
+		if pages[i].SectionID == sectionID {
+			current = i
+		}
+	}
+	if current < 0 {
+		return ErrPageNotReached
+	}
+
+	visible := logic.VisibleOnPath(pages, values)
+	fields = append(fields, checkQuestions(pages[current].Questions, values, visible)...)
+
+	if len(fields) > 0 {
+		return &Error{Fields: fields}
+	}
+	return nil
+}
+
+// checkQuestions applies the visibility, required and type checks to
+// questions.
+func checkQuestions(questions []models.Question, values map[uint]string, visible map[uint]bool) []FieldError {
+	var fields []FieldError
+	add := func(q models.Question, fe FieldError) {
+		fe.SectionID = q.SectionID
+		fields = append(fields, fe)
+	}
+
+	for _, q := range questions {
+		value, answered := values[q.ID]
+		empty := !answered || logic.IsEmptyAnswer(q.Type, value)
+
+		if !visible[q.ID] {
+			// Hidden questions are never required, but must not be answered.
+			if !empty {
+				add(q, fieldError(q.ID, CodeHidden, "question is hidden by the survey logic"))
+			}
+			continue
+		}
+		if empty {
+			if q.IsRequired {
+				add(q, fieldError(q.ID, CodeRequired, "answer is required"))
+			}
+			continue
+		}
+		if fe := validateValue(q, value); fe != nil {
+			add(q, *fe)
+		} else if fe := checkComplete(q, value); fe != nil {
+			add(q, *fe)
+		}
+	}
+	return fields
+}
+
+// ValidateAnswers checks a partial set of answers, as saved while a response
+// is still being filled in. Each non-empty answer must be valid for its
+// question; required and hidden questions are only checked by
+// ValidateResponse once the response is complete, since they depend on
+// answers that may not have been given yet.
+func ValidateAnswers(questions []models.Question, answers []models.Answer) error {
+	values, fields := collectValues(questions, answers)
+
+	for _, q := range questions {
+		value, answered := values[q.ID]
+		if !answered || logic.IsEmptyAnswer(q.Type, value) {
+			continue
+		}
+		if fe := validateValue(q, value); fe != nil {
+			fe.SectionID = q.SectionID
+			fields = append(fields, *fe)
+		}
+	}
+
+	if len(fields) > 0 {
+		return &Error{Fields: fields}
+	}
+	return nil
+}
+
+// collectValues maps answers by question ID, reporting answers to unknown
+// questions and questions answered twice.
+func collectValues(questions []models.Question, answers []models.Answer) (map[uint]string, []FieldError) {
+	known := make(map[uint]bool, len(questions))
+	for _, q := range questions {
+		known[q.ID] = true
+	}
+
+	values := make(map[uint]string, len(answers))
+	var fields []FieldError
+	for _, a := range answers {
+		if !known[a.QuestionID] {
+			fields = append(fields, fieldError(a.QuestionID, CodeUnknownQuestion, "question does not belong to this survey"))
+			continue
+		}
+		if _, ok := values[a.QuestionID]; ok {
+			fields = append(fields, fieldError(a.QuestionID, CodeDuplicateAnswer, "question was answered more than once"))
+			continue
+		}
+		values[a.QuestionID] = a.Value
+	}
+	return values, fields
+}
+
+// validateValue runs the type specific check of a non-empty answer.
+func validateValue(q models.Question, value string) *FieldError {
+	if validate, ok := validators[QuestionType(q)]; ok {
+		return validate(q, value)
+	}
+	return nil
+}
+
+func fieldError(questionID uint, code, message string) FieldError {
+	return FieldError{QuestionID: questionID, Code: code, Message: message}
+}
+
+// validateChoice checks that every selected value is one of the question's
+// options. Checkbox questions and questions with AllowMultiple accept a JSON
+// array of values, whose length is bounded by MinValue and MaxValue.
+func validateChoice(q models.Question, value string) *FieldError {
+	selected, multi := logic.MultiValues(value)
+	if !multi {
+		selected = []string{value}
+	}
+
+	allowMultiple := q.AllowMultiple || q.Type == "checkbox"
+	if len(selected) > 1 && !allowMultiple {
+		fe := fieldError(q.ID, CodeMultipleNotAllowed, "only one option may be selected")
+		return &fe
+	}
+	if allowMultiple {
+		if q.MinValue != nil && len(selected) < *q.MinValue {
+			fe := fieldError(q.ID, CodeTooFewSelections, fmt.Sprintf("select at least %d options", *q.MinValue))
+			return &fe
+		}
+		if q.MaxValue != nil && len(selected) > *q.MaxValue {
+			fe := fieldError(q.ID, CodeTooManySelections, fmt.Sprintf("select at most %d options", *q.MaxValue))
+			return &fe
+		}
+	}
+
+	if len(q.Options) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool, len(q.Options))
+	for _, o := range q.Options {
+		allowed[OptionValue(o)] = true
+	}
+	for _, s := range selected {
+		if !allowed[s] {
+			fe := fieldError(q.ID, CodeInvalidOption, fmt.Sprintf("%q is not a valid option", s))
+			return &fe
+		}
+	}
+	return nil
+}
+
+// validateInteger checks rating and scale answers against MinValue and
+// MaxValue.
+func validateInteger(q models.Question, value string) *FieldError {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		fe := fieldError(q.ID, CodeNotANumber, "answer must be a whole number")
+		return &fe
+	}
+	if q.MinValue != nil && n < *q.MinValue {
+		fe := fieldError(q.ID, CodeBelowMinimum, fmt.Sprintf("answer must be at least %d", *q.MinValue))
+		return &fe
+	}
+	if q.MaxValue != nil && n > *q.MaxValue {
+		fe := fieldError(q.ID, CodeAboveMaximum, fmt.Sprintf("answer must be at most %d", *q.MaxValue))
+		return &fe
+	}
+	return nil
+}
+
+// validateText uses MinValue and MaxValue as bounds on the answer length in
+// characters.
+func validateText(q models.Question, value string) *FieldError {
+	length := utf8.RuneCountInString(value)
+	if q.MinValue != nil && length < *q.MinValue {
+		fe := fieldError(q.ID, CodeTooShort, fmt.Sprintf("answer must be at least %d characters", *q.MinValue))
+		return &fe
+	}
+	if q.MaxValue != nil && length > *q.MaxValue {
+		fe := fieldError(q.ID, CodeTooLong, fmt.Sprintf("answer must be at most %d characters", *q.MaxValue))
+		return &fe
+	}
+	return nil
+}
+
+// OptionValue is the value stored in Answer.Value when an option is selected.
+// Options without an explicit Value fall back to their Text.
+func OptionValue(o models.Option) string {
+	if o.Value != "" {
+		return o.Value
+	}
+	return o.Text
+}
@@ -0,0 +1,184 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func fieldCodes(t *testing.T, err error) map[uint]string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var validationErr *Error
+	require.ErrorAs(t, err, &validationErr)
+	codes := make(map[uint]string)
+	for _, f := range validationErr.Fields {
+		codes[f.QuestionID] = f.Code
+	}
+	return codes
+}
+
+func TestValidateResponse(t *testing.T) {
+	questions := []models.Question{
+		{
+			Model:      gorm.Model{ID: 1},
+			Type:       "multipleChoice",
+			IsRequired: true,
+			Options:    []models.Option{{Text: "Red", Value: "red"}, {Text: "Blue"}},
+		},
+		{
+			Model:    gorm.Model{ID: 2},
+			Type:     "checkbox",
+			MaxValue: intPtr(2),
+			Options:  []models.Option{{Value: "a"}, {Value: "b"}, {Value: "c"}},
+		},
+		{Model: gorm.Model{ID: 3}, Type: "rating", MinValue: intPtr(1), MaxValue: intPtr(5)},
+		{Model: gorm.Model{ID: 4}, Type: "text", MaxValue: intPtr(5)},
+		{
+			Model:      gorm.Model{ID: 5},
+			Type:       "text",
+			IsRequired: true,
+			Conditions: []models.Condition{{DependentOnID: 1, Operator: "equals", DependentOnValue: "red"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		answers []models.Answer
+		want    map[uint]string
+	}{
+		{
+			name:    "valid",
+			answers: []models.Answer{{QuestionID: 1, Value: "Blue"}, {QuestionID: 2, Value: `["a","c"]`}, {QuestionID: 3, Value: "4"}},
+		},
+		{
+			name:    "required missing",
+			answers: []models.Answer{},
+			want:    map[uint]string{1: CodeRequired},
+		},
+		{
+			name:    "required when shown by logic",
+			answers: []models.Answer{{QuestionID: 1, Value: "red"}},
+			want:    map[uint]string{5: CodeRequired},
+		},
+		{
+			name:    "hidden question answered",
+			answers: []models.Answer{{QuestionID: 1, Value: "Blue"}, {QuestionID: 5, Value: "hi"}},
+			want:    map[uint]string{5: CodeHidden},
+		},
+		{
+			name:    "unknown question and duplicate",
+			answers: []models.Answer{{QuestionID: 1, Value: "red"}, {QuestionID: 1, Value: "red"}, {QuestionID: 99, Value: "x"}, {QuestionID: 5, Value: "ok"}},
+			want:    map[uint]string{1: CodeDuplicateAnswer, 99: CodeUnknownQuestion},
+		},
+		{
+			name: "every field reported",
+			answers: []models.Answer{
+				{QuestionID: 1, Value: `["red","Blue"]`},
+				{QuestionID: 2, Value: `["a","b","c"]`},
+				{QuestionID: 3, Value: "9"},
+				{QuestionID: 4, Value: "too long"},
+			},
+			want: map[uint]string{1: CodeMultipleNotAllowed, 2: CodeTooManySelections, 3: CodeAboveMaximum, 4: CodeTooLong},
+		},
+		{
+			name:    "invalid option and number",
+			answers: []models.Answer{{QuestionID: 1, Value: "green"}, {QuestionID: 3, Value: "four"}},
+			want:    map[uint]string{1: CodeInvalidOption, 3: CodeNotANumber},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, fieldCodes(t, ValidateResponse(questions, tt.answers)))
+		})
+	}
+}
+
+func TestValidateAnswers(t *testing.T) {
+	questions := []models.Question{
+		{Model: gorm.Model{ID: 1}, Type: "multipleChoice", IsRequired: true, Options: []models.Option{{Value: "red"}, {Value: "blue"}}},
+		{Model: gorm.Model{ID: 2}, Type: "rating", MinValue: intPtr(1), MaxValue: intPtr(5)},
+		{
+			Model:      gorm.Model{ID: 3},
+			Type:       "text",
+			IsRequired: true,
+			Conditions: []models.Condition{{DependentOnID: 1, Operator: "equals", DependentOnValue: "red"}},
+		},
+	}
+
+	// Missing required answers are fine while the response is incomplete.
+	assert.NoError(t, ValidateAnswers(questions, []models.Answer{{QuestionID: 2, Value: "4"}}))
+	assert.NoError(t, ValidateAnswers(questions, []models.Answer{{QuestionID: 1, Value: ""}}))
+	// So are answers to questions the logic hides so far.
+	assert.NoError(t, ValidateAnswers(questions, []models.Answer{{QuestionID: 3, Value: "hello"}}))
+
+	err := ValidateAnswers(questions, []models.Answer{
+		{QuestionID: 1, Value: "green"},
+		{QuestionID: 2, Value: "9"},
+		{QuestionID: 7, Value: "x"},
+	})
+	assert.Equal(t, map[uint]string{
+		1: CodeInvalidOption,
+		2: CodeAboveMaximum,
+		7: CodeUnknownQuestion,
+	}, fieldCodes(t, err))
+
+	err = ValidateAnswers(questions, []models.Answer{{QuestionID: 2, Value: "1"}, {QuestionID: 2, Value: "2"}})
+	assert.Equal(t, map[uint]string{2: CodeDuplicateAnswer}, fieldCodes(t, err))
+}
+
+func TestQuestionTypeAliases(t *testing.T) {
+	question := models.Question{Model: gorm.Model{ID: 1}, Type: "multiple_choice", Options: []models.Option{{Value: "red"}}}
+	assert.Equal(t, "multipleChoice", QuestionType(question))
+
+	assert.NoError(t, ValidateResponse([]models.Question{question}, []models.Answer{{QuestionID: 1, Value: "red"}}))
+	err := ValidateResponse([]models.Question{question}, []models.Answer{{QuestionID: 1, Value: "green"}})
+	assert.Equal(t, map[uint]string{1: CodeInvalidOption}, fieldCodes(t, err))
+}
+
+func TestValidatePages(t *testing.T) {
+	first, second, third := uint(10), uint(20), uint(30)
+	sections := []models.Section{
+		{Model: gorm.Model{ID: first}, Order: 1, Rules: []models.PageRule{
+			{QuestionID: 1, Operator: "equals", Value: "no", GoToSectionID: &third},
+		}},
+		{Model: gorm.Model{ID: second}, Order: 2},
+		{Model: gorm.Model{ID: third}, Order: 3},
+	}
+	questions := []models.Question{
+		{Model: gorm.Model{ID: 1}, SectionID: &first, Type: "text", IsRequired: true},
+		{Model: gorm.Model{ID: 2}, SectionID: &second, Type: "text", IsRequired: true},
+		{Model: gorm.Model{ID: 3}, SectionID: &third, Type: "rating", MaxValue: intPtr(5)},
+	}
+
+	err := ValidatePage(sections, questions, first, nil)
+	assert.Equal(t, map[uint]string{1: CodeRequired}, fieldCodes(t, err))
+	var validationErr *Error
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, &first, validationErr.Fields[0].SectionID)
+
+	// Only the finished page is checked.
+	assert.NoError(t, ValidatePage(sections, questions, first, []models.Answer{{QuestionID: 1, Value: "yes"}}))
+	err = ValidatePage(sections, questions, third, []models.Answer{{QuestionID: 1, Value: "yes"}, {QuestionID: 3, Value: "7"}})
+	assert.Equal(t, map[uint]string{3: CodeAboveMaximum}, fieldCodes(t, err))
+
+	// Answering "no" skips the second page.
+	err = ValidatePage(sections, questions, second, []models.Answer{{QuestionID: 1, Value: "no"}})
+	assert.ErrorIs(t, err, ErrPageNotReached)
+	assert.NoError(t, ValidateSurveyResponse(sections, questions, []models.Answer{{QuestionID: 1, Value: "no"}}))
+
+	err = ValidateSurveyResponse(sections, questions, []models.Answer{{QuestionID: 1, Value: "no"}, {QuestionID: 2, Value: "x"}})
+	assert.Equal(t, map[uint]string{2: CodeHidden}, fieldCodes(t, err))
+	err = ValidateSurveyResponse(sections, questions, []models.Answer{{QuestionID: 1, Value: "yes"}})
+	assert.Equal(t, map[uint]string{2: CodeRequired}, fieldCodes(t, err))
+}
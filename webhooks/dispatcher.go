@@ -0,0 +1,284 @@
+// Package webhooks delivers survey events to the URLs users register.
+//
+// Events are written to the webhook_deliveries table (a Postgres backed
+// outbox) and a pool of workers sends them. Failed deliveries are retried with
+// exponential backoff and jitter until MaxAttempts is reached, after which the
+// delivery is dead-lettered. Every HTTP attempt is stored in
+// webhook_attempts.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/nikhilsahni7/SurveyX/webhooks/signature"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Delivery states.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+const (
+	// maxResponseBody is how much of the receiver's response body is kept.
+	maxResponseBody = 4 << 10
+
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+)
+
+// wake nudges idle workers when a delivery is enqueued in this process.
+var wake = make(chan struct{}, 1)
+
+// Enqueue queues payload for delivery to webhook. Pass the transaction that
+// writes the change being reported so the event is only sent if it commits.
+func Enqueue(tx *gorm.DB, webhook models.Webhook, event string, payload []byte) (*models.WebhookDelivery, error) {
+	delivery := models.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		Event:         event,
+		Payload:       string(payload),
+		Status:        StatusPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := tx.Create(&delivery).Error; err != nil {
+		return nil, err
+	}
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return &delivery, nil
+}
+
+// Dispatcher runs the worker pool that sends queued deliveries.
+type Dispatcher struct {
+	DB           *gorm.DB
+	Client       *http.Client
+	Workers      int
+	MaxAttempts  int
+	PollInterval time.Duration
+	// Lease is how long a claimed delivery stays invisible to other workers.
+	// A delivery whose worker died is picked up again once it runs out.
+	Lease time.Duration
+}
+
+// NewDispatcher returns a dispatcher configured from WEBHOOK_WORKERS and
+// WEBHOOK_MAX_ATTEMPTS, using NewClient.
+func NewDispatcher(db *gorm.DB) *Dispatcher {
+	client := NewClient()
+	return &Dispatcher{
+		DB:           db,
+		Client:       client,
+		Workers:      envInt("WEBHOOK_WORKERS", 4),
+		MaxAttempts:  envInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		PollInterval: 2 * time.Second,
+		Lease:        client.Timeout + 30*time.Second,
+	}
+}
+
+// NewClient returns the HTTP client used to call webhooks. It enforces
+// DefaultPolicy and times out after WEBHOOK_TIMEOUT_SECONDS.
+func NewClient() *http.Client {
+	return DefaultPolicy().Client(time.Duration(envInt("WEBHOOK_TIMEOUT_SECONDS", 10)) * time.Second)
+}
+
+// Start launches the workers. They stop when ctx is cancelled.
+func (d *Dispatcher) Start(ctx context.Context) {
+	for i := 0; i < d.Workers; i++ {
+		go d.work(ctx)
+	}
+	log.Printf("Webhook dispatcher started with %d workers", d.Workers)
+}
+
+func (d *Dispatcher) work(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain everything that is due before waiting again.
+		for {
+			delivery, err := d.claim()
+			if err != nil {
+				log.Printf("Error claiming webhook delivery: %v", err)
+				break
+			}
+			if delivery == nil {
+				break
+			}
+			d.deliver(ctx, delivery)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// claim locks the next due delivery and pushes its NextAttemptAt past the
+// lease so no other worker picks it up while it is being sent.
+func (d *Dispatcher) claim() (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", StatusPending, time.Now()).
+			Order("next_attempt_at").
+			First(&delivery).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&delivery).Update("next_attempt_at", time.Now().Add(d.Lease)).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// deliver makes one attempt and records its outcome.
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	var webhook models.Webhook
+	if err := d.DB.First(&webhook, delivery.WebhookID).Error; err != nil {
+		// The webhook was deleted; nothing left to deliver to.
+		d.finish(delivery, models.WebhookAttempt{Error: "webhook no longer exists"}, StatusDead)
+		return
+	}
+
+	attempt := d.send(ctx, webhook, delivery)
+	delivery.Attempts++
+
+	switch {
+	case attempt.Error == "" && attempt.StatusCode >= 200 && attempt.StatusCode < 300:
+		d.finish(delivery, attempt, StatusSucceeded)
+	case attempt.Blocked, delivery.Attempts >= d.MaxAttempts:
+		// Retrying a blocked target cannot succeed.
+		d.finish(delivery, attempt, StatusDead)
+	default:
+		delivery.NextAttemptAt = time.Now().Add(Backoff(delivery.Attempts))
+		d.finish(delivery, attempt, StatusPending)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, webhook models.Webhook, delivery *models.WebhookDelivery) models.WebhookAttempt {
+	result := Send(ctx, d.Client, webhook, delivery.Event, strconv.FormatUint(uint64(delivery.ID), 10), []byte(delivery.Payload))
+
+	attempt := models.WebhookAttempt{
+		DeliveryID:   delivery.ID,
+		StatusCode:   result.StatusCode,
+		LatencyMs:    result.Latency.Milliseconds(),
+		ResponseBody: result.Body,
+	}
+	if result.Err != nil {
+		attempt.Error = result.Err.Error()
+		attempt.Blocked = errors.Is(result.Err, ErrBlocked)
+	}
+	return attempt
+}
+
+// Result is the outcome of a single request to a webhook.
+type Result struct {
+	StatusCode int
+	Header     http.Header
+	// Body is the start of the receiver's response body.
+	Body    string
+	Latency time.Duration
+	Err     error
+}
+
+// Send signs payload and posts it to the webhook once.
+func Send(ctx context.Context, client *http.Client, webhook models.Webhook, event, deliveryID string, payload []byte) Result {
+	var result Result
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SurveyX-Webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set("X-Webhook-Delivery", deliveryID)
+	req.Header.Set(signature.Header, signature.Sign(payload, time.Now(), SigningSecrets(webhook)...))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	result.StatusCode = resp.StatusCode
+	result.Header = resp.Header
+	result.Body = string(body)
+	return result
+}
+
+func (d *Dispatcher) finish(delivery *models.WebhookDelivery, attempt models.WebhookAttempt, status string) {
+	attempt.DeliveryID = delivery.ID
+	delivery.Status = status
+	delivery.LastError = attempt.Error
+	if attempt.Error == "" && status != StatusSucceeded {
+		delivery.LastError = fmt.Sprintf("receiver responded with status %d", attempt.StatusCode)
+	}
+	if status == StatusSucceeded {
+		now := time.Now()
+		delivery.DeliveredAt = &now
+	}
+
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+		return tx.Model(delivery).Select("status", "attempts", "next_attempt_at", "last_error", "delivered_at").Updates(delivery).Error
+	})
+	if err != nil {
+		log.Printf("Error recording webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// Backoff returns the wait before the next attempt after the given number of
+// failed attempts: exponential from baseBackoff, capped at maxBackoff, with
+// jitter over the upper half of the interval.
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	wait := maxBackoff
+	if attempts < 20 {
+		if exp := baseBackoff << (attempts - 1); exp < maxBackoff {
+			wait = exp
+		}
+	}
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
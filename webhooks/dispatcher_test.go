@@ -0,0 +1,62 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/nikhilsahni7/SurveyX/webhooks/signature"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		min, max time.Duration
+	}{
+		{0, 5 * time.Second, 10 * time.Second},
+		{1, 5 * time.Second, 10 * time.Second},
+		{2, 10 * time.Second, 20 * time.Second},
+		{4, 40 * time.Second, 80 * time.Second},
+		{10, 30 * time.Minute, time.Hour},
+		{100, 30 * time.Minute, time.Hour},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			wait := Backoff(tt.attempts)
+			assert.GreaterOrEqual(t, wait, tt.min, "attempts=%d", tt.attempts)
+			assert.LessOrEqual(t, wait, tt.max, "attempts=%d", tt.attempts)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	var received http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.Header().Set("X-Receiver", "ok")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("thanks"))
+	}))
+	defer server.Close()
+
+	webhook := models.Webhook{URL: server.URL, Secret: "secret"}
+	payload := []byte(`{"event":"survey.created"}`)
+	result := Send(context.Background(), server.Client(), webhook, "survey.created", "test", payload)
+
+	assert.NoError(t, result.Err)
+	assert.Equal(t, http.StatusAccepted, result.StatusCode)
+	assert.Equal(t, "ok", result.Header.Get("X-Receiver"))
+	assert.Equal(t, "thanks", result.Body)
+	assert.Equal(t, payload, body)
+	assert.Equal(t, "survey.created", received.Get("X-Webhook-Event"))
+	assert.Empty(t, received.Get("X-Webhook-Secret"))
+	assert.NoError(t, signature.Verify(received.Get(signature.Header), body, "secret", signature.DefaultTolerance))
+}
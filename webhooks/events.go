@@ -0,0 +1,146 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"gorm.io/gorm"
+)
+
+// Event is the type of a webhook event.
+type Event string
+
+const (
+	EventSurveyCreated     Event = "survey.created"
+	EventSurveyUpdated     Event = "survey.updated"
+	EventSurveyPublished   Event = "survey.published"
+	EventSurveyUnpublished Event = "survey.unpublished"
+	// EventSurveyClosed is sent once per survey, when its response limit
+	// fills or, from the periodic sweeper, after its close date passes.
+	EventSurveyClosed      Event = "survey.closed"
+	EventResponseSubmitted Event = "response.submitted"
+	EventResponseDeleted   Event = "response.deleted"
+	EventTeamMemberAdded   Event = "team.member_added"
+	EventExportCompleted   Event = "export.completed"
+)
+
+// Catalog lists every event a webhook can subscribe to.
+var Catalog = []Event{
+	EventSurveyCreated,
+	EventSurveyUpdated,
+	EventSurveyPublished,
+	EventSurveyUnpublished,
+	EventSurveyClosed,
+	EventResponseSubmitted,
+	EventResponseDeleted,
+	EventTeamMemberAdded,
+	EventExportCompleted,
+}
+
+// legacyEvents maps event names used before the catalog existed.
+var legacyEvents = map[string]Event{
+	"response_submitted": EventResponseSubmitted,
+}
+
+// PayloadVersion is the version of the envelope and data format. It is bumped
+// whenever a change could break receivers.
+const PayloadVersion = 1
+
+// Envelope is the JSON body of every webhook request.
+type Envelope struct {
+	Version    int         `json:"version"`
+	Event      Event       `json:"event"`
+	OccurredAt time.Time   `json:"occurredAt"`
+	Data       interface{} `json:"data"`
+}
+
+// NormalizeEvents checks that every entry is a catalog event, translating
+// legacy names, and drops duplicates.
+func NormalizeEvents(events models.EventList) (models.EventList, error) {
+	normalized := make(models.EventList, 0, len(events))
+	for _, name := range events {
+		event, ok := ParseEvent(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown webhook event %q", name)
+		}
+		if !normalized.Has(string(event)) {
+			normalized = append(normalized, string(event))
+		}
+	}
+	return normalized, nil
+}
+
+// Subscribed reports whether webhook wants event.
+func Subscribed(webhook models.Webhook, event Event) bool {
+	for _, name := range webhook.Events {
+		if e, ok := ParseEvent(name); ok && e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseEvent returns the catalog event with the given name, accepting legacy
+// names.
+func ParseEvent(name string) (Event, bool) {
+	if e, ok := legacyEvents[name]; ok {
+		return e, true
+	}
+	for _, e := range Catalog {
+		if string(e) == name {
+			return e, true
+		}
+	}
+	return "", false
+}
+
+// Encode renders the body that is sent for event.
+func Encode(event Event, data interface{}) ([]byte, error) {
+	return json.Marshal(Envelope{
+		Version:    PayloadVersion,
+		Event:      event,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	})
+}
+
+// Publish queues event for every webhook of the survey that is subscribed to
+// it. Call it in the transaction that makes the change.
+func Publish(tx *gorm.DB, surveyID uint, event Event, data interface{}) error {
+	var hooks []models.Webhook
+	if err := tx.Where("survey_id = ?", surveyID).Find(&hooks).Error; err != nil {
+		return err
+	}
+	return enqueueAll(tx, hooks, event, data)
+}
+
+// PublishTeam queues event for the subscribed webhooks of every survey that
+// belongs to the team.
+func PublishTeam(tx *gorm.DB, teamID uint, event Event, data interface{}) error {
+	var hooks []models.Webhook
+	if err := tx.Where("survey_id IN (SELECT id FROM surveys WHERE team_id = ? AND deleted_at IS NULL)", teamID).Find(&hooks).Error; err != nil {
+		return err
+	}
+	return enqueueAll(tx, hooks, event, data)
+}
+
+func enqueueAll(tx *gorm.DB, hooks []models.Webhook, event Event, data interface{}) error {
+	var payload []byte
+	for _, hook := range hooks {
+		if !Subscribed(hook, event) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			if payload, err = Encode(event, data); err != nil {
+				return err
+			}
+		}
+		if _, err := Enqueue(tx, hook, string(event), payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEvents(t *testing.T) {
+	events, err := NormalizeEvents(models.EventList{"response_submitted", "survey.created", "response.submitted"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.EventList{"response.submitted", "survey.created"}, events)
+
+	_, err = NormalizeEvents(models.EventList{"survey.exploded"})
+	assert.Error(t, err)
+}
+
+func TestSubscribed(t *testing.T) {
+	webhook := models.Webhook{Events: models.EventList{"response_submitted", "survey.published"}}
+
+	assert.True(t, Subscribed(webhook, EventResponseSubmitted))
+	assert.True(t, Subscribed(webhook, EventSurveyPublished))
+	assert.False(t, Subscribed(webhook, EventSurveyCreated))
+}
+
+func TestEventListJSON(t *testing.T) {
+	var webhook models.Webhook
+	assert.NoError(t, json.Unmarshal([]byte(`{"Events":"survey.created, response.submitted"}`), &webhook))
+	assert.Equal(t, models.EventList{"survey.created", "response.submitted"}, webhook.Events)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"Events":["survey.closed"]}`), &webhook))
+	assert.Equal(t, models.EventList{"survey.closed"}, webhook.Events)
+
+	var scanned models.EventList
+	value, err := webhook.Events.Value()
+	assert.NoError(t, err)
+	assert.NoError(t, scanned.Scan(value))
+	assert.Equal(t, webhook.Events, scanned)
+}
+
+func TestEncode(t *testing.T) {
+	body, err := Encode(EventSurveyCreated, map[string]int{"id": 1})
+	assert.NoError(t, err)
+
+	var envelope map[string]interface{}
+	assert.NoError(t, json.Unmarshal(body, &envelope))
+	assert.Equal(t, float64(PayloadVersion), envelope["version"])
+	assert.Equal(t, "survey.created", envelope["event"])
+	assert.Equal(t, map[string]interface{}{"id": float64(1)}, envelope["data"])
+}
@@ -0,0 +1,231 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrBlocked is returned, possibly wrapped, when a webhook URL or the address
+// it resolves to is not allowed by the policy.
+var ErrBlocked = errors.New("webhook target blocked by URL policy")
+
+// blockedRanges are never called unless explicitly allowed: loopback, private,
+// link-local (including cloud metadata at 169.254.169.254), carrier-grade NAT,
+// multicast and other special purpose ranges.
+var blockedRanges = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+}
+
+// Policy decides which URLs webhooks may call.
+type Policy struct {
+	Schemes []string
+	// Allow lists ranges that may be called even though they are blocked.
+	Allow []*net.IPNet
+	// Deny lists ranges that are blocked in addition to the built-in ones.
+	Deny []*net.IPNet
+}
+
+var (
+	defaultPolicy     *Policy
+	defaultPolicyOnce sync.Once
+)
+
+// DefaultPolicy returns the policy configured by WEBHOOK_ALLOWED_SCHEMES
+// (default "http,https"), WEBHOOK_ALLOW_CIDRS and WEBHOOK_DENY_CIDRS, all
+// comma separated.
+func DefaultPolicy() *Policy {
+	defaultPolicyOnce.Do(func() {
+		defaultPolicy = &Policy{
+			Schemes: []string{"http", "https"},
+			Allow:   parseCIDRs(os.Getenv("WEBHOOK_ALLOW_CIDRS")),
+			Deny:    parseCIDRs(os.Getenv("WEBHOOK_DENY_CIDRS")),
+		}
+		if schemes := splitList(os.Getenv("WEBHOOK_ALLOWED_SCHEMES")); len(schemes) > 0 {
+			defaultPolicy.Schemes = schemes
+		}
+	})
+	return defaultPolicy
+}
+
+// ParseURL parses raw and checks its scheme and, if the host is an IP
+// literal, its address. Host names are checked when they are dialed.
+func (p *Policy) ParseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if !p.allowsScheme(u.Scheme) {
+		return nil, fmt.Errorf("%w: scheme %q is not allowed", ErrBlocked, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("invalid webhook URL: missing host")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		if err := p.CheckIP(ip); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// CheckURL is ParseURL followed by resolving the host and checking every
+// address it resolves to. It is used when a webhook is saved.
+func (p *Policy) CheckURL(ctx context.Context, raw string) error {
+	u, err := p.ParseURL(raw)
+	if err != nil {
+		return err
+	}
+	if net.ParseIP(u.Hostname()) != nil {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("cannot resolve webhook host %q: %w", u.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if err := p.CheckIP(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckIP returns an ErrBlocked error unless ip may be called.
+func (p *Policy) CheckIP(ip net.IP) error {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	if containsIP(p.Allow, ip) {
+		return nil
+	}
+	if containsIP(builtinBlocked, ip) || containsIP(p.Deny, ip) {
+		return fmt.Errorf("%w: address %s is not allowed", ErrBlocked, ip)
+	}
+	return nil
+}
+
+// Client returns an HTTP client that only connects to addresses allowed by
+// the policy. The address is checked after DNS resolution, at connect time, so
+// a host name that changes what it resolves to cannot reach a blocked address.
+// Proxies from the environment are not used since they would hide the target.
+func (p *Policy) Client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("%w: unresolved address %s", ErrBlocked, address)
+			}
+			return p.CheckIP(ip)
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: policyTransport{policy: p, base: transport},
+	}
+}
+
+// policyTransport checks every request URL, including redirects, before it is
+// sent.
+type policyTransport struct {
+	policy *Policy
+	base   http.RoundTripper
+}
+
+func (t policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, err := t.policy.ParseURL(req.URL.String()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+func (p *Policy) allowsScheme(scheme string) bool {
+	for _, s := range p.Schemes {
+		if strings.EqualFold(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+var builtinBlocked = mustParseCIDRs(blockedRanges)
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCIDRs(list string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range splitList(list) {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Printf("Ignoring invalid webhook CIDR %q: %v", cidr, err)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func mustParseCIDRs(list []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, cidr := range list {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,73 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckIP(t *testing.T) {
+	policy := &Policy{Schemes: []string{"https"}}
+
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.20.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fd00::1", "fe80::1", "::ffff:127.0.0.1"} {
+		assert.ErrorIs(t, policy.CheckIP(net.ParseIP(ip)), ErrBlocked, ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "2606:4700:4700::1111"} {
+		assert.NoError(t, policy.CheckIP(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestCheckIPAllowAndDeny(t *testing.T) {
+	policy := &Policy{
+		Allow: parseCIDRs("10.0.0.0/24"),
+		Deny:  parseCIDRs("8.8.8.0/24, not-a-cidr"),
+	}
+
+	assert.NoError(t, policy.CheckIP(net.ParseIP("10.0.0.5")))
+	assert.ErrorIs(t, policy.CheckIP(net.ParseIP("10.0.1.5")), ErrBlocked)
+	assert.ErrorIs(t, policy.CheckIP(net.ParseIP("8.8.8.8")), ErrBlocked)
+}
+
+func TestCheckURL(t *testing.T) {
+	policy := &Policy{Schemes: []string{"https"}}
+	ctx := context.Background()
+
+	assert.NoError(t, policy.CheckURL(ctx, "https://93.184.216.34/hook"))
+	assert.ErrorIs(t, policy.CheckURL(ctx, "http://93.184.216.34/hook"), ErrBlocked)
+	assert.ErrorIs(t, policy.CheckURL(ctx, "file:///etc/passwd"), ErrBlocked)
+	assert.ErrorIs(t, policy.CheckURL(ctx, "https://169.254.169.254/latest/meta-data"), ErrBlocked)
+	assert.ErrorIs(t, policy.CheckURL(ctx, "https://[::1]:8080/"), ErrBlocked)
+	assert.ErrorIs(t, policy.CheckURL(ctx, "https://localhost/"), ErrBlocked)
+	assert.Error(t, policy.CheckURL(ctx, "https:///path"))
+}
+
+func TestClientBlocksAtDial(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	webhook := models.Webhook{URL: server.URL, Secret: "secret"}
+	policy := &Policy{Schemes: []string{"http"}}
+
+	result := Send(context.Background(), policy.Client(time.Second), webhook, "survey.created", "1", []byte(`{}`))
+	assert.True(t, errors.Is(result.Err, ErrBlocked), "%v", result.Err)
+
+	// A host name is only resolved when dialing, where the address is checked.
+	byName := webhook
+	byName.URL = strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	result = Send(context.Background(), policy.Client(time.Second), byName, "survey.created", "1", []byte(`{}`))
+	assert.True(t, errors.Is(result.Err, ErrBlocked), "%v", result.Err)
+
+	// The test server listens on loopback, so it has to be allowed explicitly.
+	policy.Allow = parseCIDRs("127.0.0.0/8")
+	result = Send(context.Background(), policy.Client(time.Second), webhook, "survey.created", "1", []byte(`{}`))
+	assert.NoError(t, result.Err)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+}
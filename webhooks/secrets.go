@@ -0,0 +1,47 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+)
+
+// NewSecret returns a random signing secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// SigningSecrets returns the secrets requests to webhook are signed with: the
+// current secret and, during a rotation's grace period, the previous one.
+func SigningSecrets(webhook models.Webhook) []string {
+	secrets := []string{webhook.Secret}
+	if webhook.PreviousSecret != "" && webhook.PreviousSecretExpiresAt != nil && time.Now().Before(*webhook.PreviousSecretExpiresAt) {
+		secrets = append(secrets, webhook.PreviousSecret)
+	}
+	return secrets
+}
+
+// Rotate replaces the webhook's secret with a new one. The old secret stays
+// valid for grace; a grace of zero drops it immediately.
+func Rotate(webhook *models.Webhook, grace time.Duration) error {
+	secret, err := NewSecret()
+	if err != nil {
+		return err
+	}
+
+	webhook.PreviousSecret = ""
+	webhook.PreviousSecretExpiresAt = nil
+	if grace > 0 && webhook.Secret != "" {
+		expires := time.Now().Add(grace)
+		webhook.PreviousSecret = webhook.Secret
+		webhook.PreviousSecretExpiresAt = &expires
+	}
+	webhook.Secret = secret
+	return nil
+}
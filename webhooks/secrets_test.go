@@ -0,0 +1,25 @@
+package webhooks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nikhilsahni7/SurveyX/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotate(t *testing.T) {
+	webhook := models.Webhook{Secret: "old"}
+
+	assert.NoError(t, Rotate(&webhook, time.Hour))
+	assert.NotEqual(t, "old", webhook.Secret)
+	assert.Equal(t, []string{webhook.Secret, "old"}, SigningSecrets(webhook))
+
+	expired := time.Now().Add(-time.Minute)
+	webhook.PreviousSecretExpiresAt = &expired
+	assert.Equal(t, []string{webhook.Secret}, SigningSecrets(webhook))
+
+	assert.NoError(t, Rotate(&webhook, 0))
+	assert.Empty(t, webhook.PreviousSecret)
+	assert.Nil(t, webhook.PreviousSecretExpiresAt)
+}
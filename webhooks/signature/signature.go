@@ -0,0 +1,101 @@
+// Package signature signs SurveyX webhook requests and lets receivers verify
+// them.
+//
+// Every request carries a header of the form
+//
+//	X-SurveyX-Signature: t=1700000000,v1=5257a869e7ecebeda32affa62cdca3fa51cad7e77a0e56ff536d0ce8e108d8bd
+//
+// where t is the Unix time the request was signed and v1 is the hex encoded
+// HMAC-SHA256 of "<t>.<body>" keyed with the webhook secret. While a rotated
+// secret is in its grace period the header holds one v1 entry per secret.
+// Receivers should accept the request if any v1 entry matches and reject
+// timestamps outside their tolerance to stop replays.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header is the name of the HTTP header that carries the signature.
+const Header = "X-SurveyX-Signature"
+
+// DefaultTolerance is how old a signature may be before Verify rejects it.
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	ErrInvalidHeader = errors.New("signature: malformed signature header")
+	ErrTooOld        = errors.New("signature: timestamp outside the tolerance")
+	ErrMismatch      = errors.New("signature: no signature matches the payload")
+)
+
+// Sign returns the header value for body signed at timestamp with each of the
+// given secrets.
+func Sign(body []byte, timestamp time.Time, secrets ...string) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	parts := []string{"t=" + t}
+	for _, secret := range secrets {
+		parts = append(parts, "v1="+hex.EncodeToString(compute(secret, t, body)))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Verify checks header against body and secret. Signatures older or newer
+// than tolerance relative to the current time are rejected; a tolerance of
+// zero disables the check.
+func Verify(header string, body []byte, secret string, tolerance time.Duration) error {
+	return verifyAt(header, body, secret, tolerance, time.Now())
+}
+
+func verifyAt(header string, body []byte, secret string, tolerance time.Duration, now time.Time) error {
+	var t string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrInvalidHeader
+		}
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			sig, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrInvalidHeader
+			}
+			signatures = append(signatures, sig)
+		}
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidHeader
+	}
+	if tolerance > 0 {
+		age := now.Sub(time.Unix(unix, 0))
+		if age > tolerance || age < -tolerance {
+			return ErrTooOld
+		}
+	}
+
+	expected := compute(secret, t, body)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrMismatch
+}
+
+func compute(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,38 @@
+package signature
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"event":"response.submitted"}`)
+	now := time.Unix(1700000000, 0)
+	header := Sign(body, now, "secret")
+
+	assert.True(t, strings.HasPrefix(header, "t=1700000000,v1="))
+	assert.NoError(t, verifyAt(header, body, "secret", DefaultTolerance, now.Add(time.Minute)))
+	assert.ErrorIs(t, verifyAt(header, body, "other", DefaultTolerance, now), ErrMismatch)
+	assert.ErrorIs(t, verifyAt(header, []byte(`{}`), "secret", DefaultTolerance, now), ErrMismatch)
+	assert.ErrorIs(t, verifyAt(header, body, "secret", DefaultTolerance, now.Add(10*time.Minute)), ErrTooOld)
+	assert.NoError(t, verifyAt(header, body, "secret", 0, now.Add(24*time.Hour)))
+}
+
+func TestVerifyDuringRotation(t *testing.T) {
+	body := []byte(`{}`)
+	now := time.Now()
+	header := Sign(body, now, "new", "old")
+
+	assert.NoError(t, Verify(header, body, "new", DefaultTolerance))
+	assert.NoError(t, Verify(header, body, "old", DefaultTolerance))
+	assert.ErrorIs(t, Verify(header, body, "other", DefaultTolerance), ErrMismatch)
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	for _, header := range []string{"", "t=abc,v1=00", "t=1700000000", "t=1700000000,v1=zz", "garbage"} {
+		assert.ErrorIs(t, Verify(header, nil, "secret", 0), ErrInvalidHeader, header)
+	}
+}